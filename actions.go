@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/flanksource/is-healthy/pkg/lua"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+type actionList struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Key       string `json:"-"`
+
+	Actions []lua.ResourceAction `json:"actions"`
+}
+
+// actionPatch is a JSON merge patch of an object patched by an action
+type actionPatch struct {
+	Kind      string          `json:"kind"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name"`
+	Operation string          `json:"operation"`
+	Patch     json.RawMessage `json:"patch"`
+}
+
+func newActionsCommand() *cobra.Command {
+	actions := &cobra.Command{
+		Use:   "actions",
+		Short: "Discover and run the resource actions of the objects read from stdin, without applying them",
+	}
+	actions.AddCommand(newActionsListCommand(), newActionsRunCommand())
+	return actions
+}
+
+func newActionsListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Short:   "List the actions available for the objects read from stdin",
+		Example: `  kubectl get rollout guestbook -o yaml | is-healthy actions list`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := getOutputFormat()
+			if err != nil {
+				return err
+			}
+			objects, err := readObjects(os.Stdin)
+			if err != nil {
+				return err
+			}
+			if len(objects) == 0 {
+				return fmt.Errorf("no objects found in input")
+			}
+
+			var lists []actionList
+			for _, obj := range objects {
+				actions, err := discoverActions(lua.VM{ResourceOverrides: overrides}, obj)
+				if err != nil {
+					return fmt.Errorf("%s: %w", objectKey(obj), err)
+				}
+				lists = append(lists, actionList{
+					Kind:      obj.GetKind(),
+					Namespace: obj.GetNamespace(),
+					Name:      obj.GetName(),
+					Key:       objectKey(obj),
+					Actions:   actions,
+				})
+			}
+			return printActionLists(os.Stdout, format, lists)
+		},
+	}
+}
+
+func newActionsRunCommand() *cobra.Command {
+	var (
+		params     []string
+		mergePatch bool
+	)
+	cmd := &cobra.Command{
+		Use:   "run <action>",
+		Short: "Run an action on the objects read from stdin and print the impacted resources",
+		Long: `Runs the action on every object read from stdin and prints the impacted resources as YAML, or JSON with
+-o json.
+
+With --merge-patch, the patched objects are printed as JSON merge patches against the input instead, created
+resources are printed as is.`,
+		Example: `  kubectl get rollout guestbook -o yaml |
+    is-healthy actions run scale --param replicas=3 --merge-patch`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := getOutputFormat()
+			if err != nil {
+				return err
+			}
+			values, err := parseParams(params)
+			if err != nil {
+				return err
+			}
+			objects, err := readObjects(os.Stdin)
+			if err != nil {
+				return err
+			}
+			if len(objects) == 0 {
+				return fmt.Errorf("no objects found in input")
+			}
+
+			var impacted []lua.ImpactedResource
+			var patches []any
+			for _, obj := range objects {
+				resources, err := runAction(lua.VM{ResourceOverrides: overrides}, obj, args[0], values)
+				if err != nil {
+					return fmt.Errorf("%s: %w", objectKey(obj), err)
+				}
+				impacted = append(impacted, resources...)
+
+				for _, resource := range resources {
+					patch, err := toMergePatch(obj, resource)
+					if err != nil {
+						return err
+					}
+					patches = append(patches, patch)
+				}
+			}
+
+			if mergePatch {
+				return printItems(os.Stdout, lo.Ternary(format == OutputText, OutputJSON, format), patches)
+			}
+			return printItems(os.Stdout, format, impacted)
+		},
+	}
+	cmd.Flags().StringArrayVar(&params, "param", nil, "Action parameter as name=value, can be repeated")
+	cmd.Flags().BoolVar(&mergePatch, "merge-patch", false, "Print JSON merge patches against the input")
+	return cmd
+}
+
+// discoverActions returns the actions of the discovery script of obj sorted by name, or none if there is no
+// discovery script
+func discoverActions(vm lua.VM, obj *unstructured.Unstructured) ([]lua.ResourceAction, error) {
+	script, err := vm.GetResourceActionDiscovery(obj)
+	if err != nil || script == "" {
+		return nil, err
+	}
+	actions, err := vm.ExecuteResourceActionDiscovery(obj, script)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].Name < actions[j].Name })
+	return actions, nil
+}
+
+// runAction validates the params against the discovered action and runs it
+func runAction(
+	vm lua.VM,
+	obj *unstructured.Unstructured,
+	name string,
+	values map[string]string,
+) ([]lua.ImpactedResource, error) {
+	discovered, err := discoverActions(vm, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var params []lua.ResourceActionParam
+	found := false
+	for _, action := range discovered {
+		if action.Name != name {
+			continue
+		}
+		found = true
+		if action.Disabled {
+			return nil, fmt.Errorf("action %s is disabled", name)
+		}
+		if params, err = action.ResolveParams(values); err != nil {
+			return nil, err
+		}
+	}
+	if len(discovered) > 0 && !found {
+		return nil, fmt.Errorf("action %s is not available for %s", name, obj.GroupVersionKind().GroupKind())
+	}
+	if params == nil && len(values) > 0 {
+		return nil, fmt.Errorf("action %s has no parameters", name)
+	}
+
+	action, err := vm.GetResourceAction(obj, name)
+	if err != nil {
+		return nil, err
+	}
+	if action.ActionLua == "" {
+		return nil, fmt.Errorf("no action %s for %s", name, obj.GroupVersionKind().GroupKind())
+	}
+	return vm.ExecuteResourceAction(obj, action.ActionLua, params...)
+}
+
+func parseParams(params []string) (map[string]string, error) {
+	values := make(map[string]string, len(params))
+	for _, param := range params {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid parameter %q, expected name=value", param)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// toMergePatch returns the merge patch of a patched resource against obj, created resources are returned as is
+func toMergePatch(obj *unstructured.Unstructured, resource lua.ImpactedResource) (any, error) {
+	if resource.K8SOperation != lua.PatchOperation {
+		return resource, nil
+	}
+	original, err := json.Marshal(obj.Object)
+	if err != nil {
+		return nil, err
+	}
+	modified, err := json.Marshal(resource.UnstructuredObj.Object)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatch.CreateMergePatch(original, modified)
+	if err != nil {
+		return nil, err
+	}
+	return actionPatch{
+		Kind:      obj.GetKind(),
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Operation: string(resource.K8SOperation),
+		Patch:     patch,
+	}, nil
+}
+
+func printItems[T any](w io.Writer, format string, items []T) error {
+	switch format {
+	case OutputJSON:
+		data, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case OutputNDJSON:
+		encoder := json.NewEncoder(w)
+		for _, item := range items {
+			if err := encoder.Encode(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case OutputText, OutputYAML:
+		data, err := yaml.Marshal(items)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	return fmt.Errorf("unsupported output format %q", format)
+}
+
+func printActionLists(w io.Writer, format string, lists []actionList) error {
+	switch format {
+	case OutputJSON, OutputNDJSON, OutputYAML:
+		return printItems(w, format, lists)
+	case OutputTable, OutputSummary:
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "KIND\tNAMESPACE\tNAME\tACTION\tDISABLED\tPARAMS")
+		for _, list := range lists {
+			for _, action := range list.Actions {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%t\t%s\n",
+					list.Kind, list.Namespace, list.Name, action.Name, action.Disabled, formatParams(action.Params))
+			}
+		}
+		return tw.Flush()
+	}
+
+	for _, list := range lists {
+		if len(lists) > 1 {
+			if _, err := fmt.Fprintf(w, "%s:\n", list.Key); err != nil {
+				return err
+			}
+		}
+		for _, action := range list.Actions {
+			line := action.Name
+			if params := formatParams(action.Params); params != "" {
+				line += " " + params
+			}
+			if action.Disabled {
+				line += " (disabled)"
+			}
+			if _, err := fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", min(len(lists)-1, 1)), line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// formatParams returns the params as name=type or name=type:default, params without a type are strings
+func formatParams(params []lua.ResourceActionParam) string {
+	var formatted []string
+	for _, param := range params {
+		s := fmt.Sprintf("%s=%s", param.Name, lo.CoalesceOrEmpty(param.Type, "string"))
+		if param.Default != "" {
+			s += ":" + param.Default
+		}
+		formatted = append(formatted, s)
+	}
+	return strings.Join(formatted, ",")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/flanksource/is-healthy/pkg/lua"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRunAction(t *testing.T) {
+	data, err := os.ReadFile(
+		"pkg/resource_customizations/argoproj.io/Rollout/actions/testdata/one_replica_rollout.yaml")
+	require.NoError(t, err)
+	objects, err := readObjects(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	rollout := objects[0]
+
+	resources, err := runAction(lua.VM{}, rollout, "scale", map[string]string{"replicas": "3"})
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	patch, err := toMergePatch(rollout, resources[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"spec": {"replicas": 3}}`, string(patch.(actionPatch).Patch))
+
+	_, err = runAction(lua.VM{}, rollout, "scale", map[string]string{"replicas": "three"})
+	assert.ErrorContains(t, err, `parameter replicas expects a value of type integer, not "three"`)
+	_, err = runAction(lua.VM{}, rollout, "restart", map[string]string{"replicas": "3"})
+	assert.ErrorContains(t, err, "action restart has no parameter replicas")
+	_, err = runAction(lua.VM{}, rollout, "missing", nil)
+	assert.ErrorContains(t, err, "action missing is not available for Rollout.argoproj.io")
+
+	// without a discovery script the action is looked up by name
+	configMap := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": "config"},
+	}}
+	_, err = runAction(lua.VM{}, configMap, "restart", nil)
+	assert.ErrorContains(t, err, "no action restart for ConfigMap")
+}
+
+func TestParseParams(t *testing.T) {
+	values, err := parseParams([]string{"replicas=3", "image=nginx:1.25=latest", "empty="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"replicas": "3", "image": "nginx:1.25=latest", "empty": ""}, values)
+
+	_, err = parseParams([]string{"replicas"})
+	assert.ErrorContains(t, err, `invalid parameter "replicas", expected name=value`)
+	_, err = parseParams([]string{"=3"})
+	assert.Error(t, err)
+}
+
+func TestFormatParams(t *testing.T) {
+	assert.Equal(t, "replicas=integer,message=string:hello world", formatParams([]lua.ResourceActionParam{
+		{Name: "replicas", Type: "integer"},
+		{Name: "message", Default: "hello world"},
+	}))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/flanksource/is-healthy/pkg/drift"
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/flanksource/is-healthy/pkg/lua"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+type diffResult struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Key       string `json:"-"`
+
+	*drift.Result
+}
+
+func newDiffCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff desired.yaml live.yaml",
+		Short: "Compare desired manifests with live objects, ignoring the configured ignoreDifferences",
+		Long: `Compares every object of the desired manifests with the live object of the same kind, namespace and name,
+ignoring the ignoreDifferences of the --argocd-cm resource customizations.
+
+Exits with 0 when all objects are in sync and 2 when any object is out of sync or missing.`,
+		Example: `  kubectl get deployment nginx -o yaml > live.yaml && is-healthy diff nginx.yaml live.yaml`,
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := getOutputFormat()
+			if err != nil {
+				return err
+			}
+
+			desired, err := readObjectsFromFile(args[0])
+			if err != nil {
+				return err
+			}
+			live, err := readObjectsFromFile(args[1])
+			if err != nil {
+				return err
+			}
+			if len(desired) == 0 {
+				return fmt.Errorf("no objects found in %s", args[0])
+			}
+
+			results, err := diffObjects(desired, live, overrides)
+			if err != nil {
+				return err
+			}
+			if err := printDiffResults(os.Stdout, format, results); err != nil {
+				return err
+			}
+
+			exitWithWorstHealth(lo.Map(results, func(r diffResult, _ int) result {
+				return result{Key: r.Key, HealthStatus: &r.HealthStatus}
+			}))
+			return nil
+		},
+	}
+}
+
+func readObjectsFromFile(path string) ([]*unstructured.Unstructured, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readObjects(f)
+}
+
+func diffObjects(
+	desired, live []*unstructured.Unstructured,
+	overrides lua.ResourceHealthOverrides,
+) ([]diffResult, error) {
+	var results []diffResult
+	for _, obj := range desired {
+		r := diffResult{
+			Kind:      obj.GetKind(),
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+			Key:       objectKey(obj),
+		}
+
+		if match := findLiveObject(obj, live); match == nil {
+			r.Result = &drift.Result{HealthStatus: health.HealthStatus{
+				Health:  health.HealthWarning,
+				Status:  health.HealthStatusMissing,
+				Message: "not found in the live objects",
+			}}
+		} else {
+			diff, err := drift.Diff(obj, match, overrides)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", r.Key, err)
+			}
+			r.Result = diff
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// findLiveObject matches on group, kind and name, and on the namespace if the desired manifest sets it
+func findLiveObject(desired *unstructured.Unstructured, live []*unstructured.Unstructured) *unstructured.Unstructured {
+	for _, obj := range live {
+		if obj.GroupVersionKind().GroupKind() == desired.GroupVersionKind().GroupKind() &&
+			obj.GetName() == desired.GetName() &&
+			(desired.GetNamespace() == "" || obj.GetNamespace() == desired.GetNamespace()) {
+			return obj
+		}
+	}
+	return nil
+}
+
+func printDiffResults(w io.Writer, format string, results []diffResult) error {
+	switch format {
+	case OutputJSON:
+		data, err := json.MarshalIndent(lo.Ternary(len(results) == 1, any(results[0]), any(results)), "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case OutputYAML:
+		data, err := yaml.Marshal(lo.Ternary(len(results) == 1, any(results[0]), any(results)))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case OutputNDJSON:
+		encoder := json.NewEncoder(w)
+		for _, r := range results {
+			if err := encoder.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case OutputTable, OutputSummary:
+		return printResults(w, format, lo.Map(results, func(r diffResult, _ int) result {
+			return result{Kind: r.Kind, Namespace: r.Namespace, Name: r.Name, Key: r.Key, HealthStatus: &r.HealthStatus}
+		}))
+	}
+
+	for _, r := range results {
+		if _, err := fmt.Fprintf(w, "%s: %s\n", r.Key, r.HealthStatus); err != nil {
+			return err
+		}
+		for _, change := range r.Changes {
+			if _, err := fmt.Fprintf(w, "  %s\n", change); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flanksource/is-healthy/pkg/drift"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffObjectsWithArgoCDConfigMap(t *testing.T) {
+	configMap := filepath.Join(t.TempDir(), "argocd-cm.yaml")
+	require.NoError(t, os.WriteFile(configMap, []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: argocd-cm
+data:
+  resource.customizations.ignoreDifferences.apps_Deployment: |
+    jqPathExpressions:
+    - .spec.template.spec.containers[] | select(.name | startswith("istio-")) | .image
+  resource.customizations.ignoreDifferences.all: |
+    jsonPointers:
+    - /spec/replicas
+`), 0o600))
+	overrides, err := loadArgoCDConfigMap(configMap)
+	require.NoError(t, err)
+
+	deployment := func(replicas, image string) string {
+		return `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "nginx", "namespace": "default"},
+"spec": {"replicas": ` + replicas + `, "template": {"spec": {"containers": [
+  {"name": "nginx", "image": "nginx"}, {"name": "istio-proxy", "image": "` + image + `"}]}}}}`
+	}
+	service := func(port string) string {
+		return `{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "nginx", "namespace": "default"},
+"spec": {"replicas": 1, "ports": [{"port": ` + port + `}]}}`
+	}
+	desired, err := readObjects(strings.NewReader(deployment("1", "istio:1") + service("80")))
+	require.NoError(t, err)
+	live, err := readObjects(strings.NewReader(deployment("3", "istio:2") + service("8080")))
+	require.NoError(t, err)
+
+	results, err := diffObjects(desired, live, overrides)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, drift.HealthStatusSynced, results[0].Status)
+	assert.Equal(t, drift.HealthStatusOutOfSync, results[1].Status)
+	assert.Equal(t, "/spec/ports/0/port", results[1].Changes[0].Path)
+
+	results, err = diffObjects(desired, live, nil)
+	require.NoError(t, err)
+	assert.Equal(t, drift.HealthStatusOutOfSync, results[0].Status)
+}
+
+func TestLoadArgoCDConfigMapErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		// the data of a ConfigMap are strings, it is not parsed as a legacy resource.customizations blob
+		"data": `kind: ConfigMap
+data:
+  resource.customizations.ignoreDifferences.all:
+    jsonPointers:
+    - /spec/replicas
+`,
+		"customizations": `kind: ConfigMap
+data:
+  resource.customizations.ignoreDifferences.all: "jsonPointers: ["
+`,
+		"legacy": `apps/Deployment: [`,
+	} {
+		file := filepath.Join(dir, name+".yaml")
+		require.NoError(t, os.WriteFile(file, []byte(data), 0o600))
+		_, err := loadArgoCDConfigMap(file)
+		assert.ErrorContains(t, err, file, name)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/spf13/cobra"
+)
+
+func newExplainCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:     "explain",
+		Short:   "Explain how the health of the objects read from stdin was determined",
+		Example: `  kubectl get deployment nginx -o yaml | is-healthy explain`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := getOutputFormat()
+			if err != nil {
+				return err
+			}
+
+			objects, err := readObjects(os.Stdin)
+			if err != nil {
+				return err
+			}
+			if len(objects) == 0 {
+				return fmt.Errorf("no objects found in input")
+			}
+
+			results, err := evaluateWithOptions(objects, health.Options{
+				Override: overrides,
+				Trace:    true,
+			})
+			if err != nil {
+				return err
+			}
+
+			if format != OutputText {
+				return printResults(os.Stdout, format, results)
+			}
+
+			for i, r := range results {
+				if i > 0 {
+					fmt.Println()
+				}
+				fmt.Printf("%s: %s\n", r.Key, *r.HealthStatus)
+				for j, step := range r.Trace {
+					fmt.Printf("  %d. %s\n", j+1, step)
+				}
+			}
+			return nil
+		},
+	}
+}
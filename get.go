@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/flanksource/is-healthy/pkg/cluster"
+	"github.com/spf13/cobra"
+)
+
+type getOptions struct {
+	kubeconfig    string
+	context       string
+	namespace     string
+	allNamespaces bool
+	selector      string
+}
+
+func newGetCommand() *cobra.Command {
+	opts := getOptions{}
+	cmd := &cobra.Command{
+		Use:   "get <kind> [name]",
+		Short: "Evaluate the health of objects in a live cluster",
+		Example: `  is-healthy get deployments -n default
+  is-healthy get pods -A -o table
+  is-healthy get certificates.cert-manager.io my-cert -n ingress`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := getOutputFormat()
+			if err != nil {
+				return err
+			}
+
+			query := cluster.Query{
+				Kind:          args[0],
+				Namespace:     opts.namespace,
+				AllNamespaces: opts.allNamespaces,
+				LabelSelector: opts.selector,
+			}
+			if len(args) > 1 {
+				query.Name = args[1]
+			}
+			if query.Name != "" && query.AllNamespaces {
+				return fmt.Errorf("a resource cannot be retrieved by name across all namespaces")
+			}
+
+			client, namespace, err := cluster.NewClientFromKubeconfig(opts.kubeconfig, opts.context)
+			if err != nil {
+				return err
+			}
+			client.Overrides = overrides
+			if query.Namespace == "" {
+				query.Namespace = namespace
+			}
+
+			found, err := client.Get(context.Background(), query)
+			if err != nil {
+				return err
+			}
+			if len(found) == 0 {
+				return fmt.Errorf("no %s found", query.Kind)
+			}
+
+			var results []result
+			for _, r := range found {
+				results = append(results, newResult(r.Object, r.Health))
+			}
+
+			if err := printResults(os.Stdout, format, results); err != nil {
+				return err
+			}
+			exitWithWorstHealth(results)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.kubeconfig, "kubeconfig", "",
+		"Path to the kubeconfig file, defaults to $KUBECONFIG or ~/.kube/config")
+	cmd.Flags().StringVar(&opts.context, "context", "", "The kubeconfig context to use")
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "",
+		"Namespace to query, defaults to the namespace of the current context")
+	cmd.Flags().BoolVarP(&opts.allNamespaces, "all-namespaces", "A", false, "Query objects across all namespaces")
+	cmd.Flags().StringVarP(&opts.selector, "selector", "l", "", "Label selector to filter on")
+	return cmd
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// readObjects reads every object from a YAML or JSON stream. Multi-document YAML (separated by `---`),
+// concatenated JSON objects, JSON arrays and kubectl style `List` kinds are all flattened into a single
+// list of objects.
+func readObjects(r io.Reader) ([]*unstructured.Unstructured, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := splitDocuments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []*unstructured.Unstructured
+	for _, doc := range docs {
+		var v any
+		if err := utilyaml.Unmarshal(doc, &v); err != nil {
+			return nil, err
+		}
+		items, err := flattenObjects(v)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, items...)
+	}
+	return objects, nil
+}
+
+func splitDocuments(data []byte) ([][]byte, error) {
+	var docs [][]byte
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+
+	if trimmed[0] == '{' || trimmed[0] == '[' {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		for {
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			docs = append(docs, raw)
+		}
+		return docs, nil
+	}
+
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+func flattenObjects(v any) ([]*unstructured.Unstructured, error) {
+	switch value := v.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		var objects []*unstructured.Unstructured
+		for _, item := range value {
+			items, err := flattenObjects(item)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, items...)
+		}
+		return objects, nil
+	case map[string]any:
+		obj := &unstructured.Unstructured{Object: value}
+		if isList(obj) {
+			items, _, _ := unstructured.NestedSlice(value, "items")
+			return flattenObjects(items)
+		}
+		return []*unstructured.Unstructured{obj}, nil
+	default:
+		return nil, fmt.Errorf("expected an object, got %T", v)
+	}
+}
+
+// isList returns true for `v1/List` and typed lists such as `PodList`
+func isList(obj *unstructured.Unstructured) bool {
+	if !strings.HasSuffix(obj.GetKind(), "List") {
+		return false
+	}
+	_, ok := obj.Object["items"].([]any)
+	return ok
+}
+
+// objectKey returns the kind/namespace/name of an object, omitting the namespace for cluster scoped objects
+func objectKey(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName())
+	}
+	return fmt.Sprintf("%s/%s/%s", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func TestReadObjects(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		keys  []string
+	}{
+		{
+			name:  "empty",
+			input: "\n\n",
+			keys:  []string{},
+		},
+		{
+			name: "multi document yaml",
+			input: `apiVersion: v1
+kind: Pod
+metadata: {name: a, namespace: default}
+---
+apiVersion: v1
+kind: Namespace
+metadata: {name: default}
+`,
+			keys: []string{"Pod/default/a", "Namespace/default"},
+		},
+		{
+			name: "empty documents",
+			input: `---
+---
+apiVersion: v1
+kind: Pod
+metadata: {name: a, namespace: default}
+---
+# only a comment
+---
+`,
+			keys: []string{"Pod/default/a"},
+		},
+		{
+			name: "list",
+			input: `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Pod
+  metadata: {name: a, namespace: default}
+- apiVersion: v1
+  kind: Pod
+  metadata: {name: b, namespace: default}
+`,
+			keys: []string{"Pod/default/a", "Pod/default/b"},
+		},
+		{
+			name:  "typed list",
+			input: `{"apiVersion": "v1", "kind": "PodList", "items": [{"kind": "Pod", "metadata": {"name": "a"}}]}`,
+			keys:  []string{"Pod/a"},
+		},
+		{
+			name: "concatenated json and arrays",
+			input: `{"kind": "Pod", "metadata": {"name": "a"}}
+[{"kind": "Pod", "metadata": {"name": "b"}}, {"kind": "Pod", "metadata": {"name": "c"}}]`,
+			keys: []string{"Pod/a", "Pod/b", "Pod/c"},
+		},
+		{
+			name: "duplicates",
+			input: `{"kind": "Pod", "metadata": {"name": "a"}, "status": {"phase": "Pending"}}
+{"kind": "Pod", "metadata": {"name": "a"}, "status": {"phase": "Running"}}`,
+			keys: []string{"Pod/a", "Pod/a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := readObjects(strings.NewReader(tt.input))
+			require.NoError(t, err)
+			assert.Equal(t, tt.keys, lo.Map(objects, func(obj *unstructured.Unstructured, _ int) string {
+				return objectKey(obj)
+			}))
+		})
+	}
+
+	t.Run("scalar", func(t *testing.T) {
+		_, err := readObjects(strings.NewReader("[1]"))
+		assert.Error(t, err)
+	})
+}
+
+func TestPrintJSONDuplicates(t *testing.T) {
+	input := `{"kind": "Pod", "metadata": {"name": "a"}, "status": {"phase": "Pending"}}
+{"kind": "Pod", "metadata": {"name": "a"}, "status": {"phase": "Running"}}`
+	objects, err := readObjects(strings.NewReader(input))
+	require.NoError(t, err)
+	results := []result{
+		newResult(objects[0], &health.HealthStatus{Status: health.HealthStatusPending}),
+		newResult(objects[1], &health.HealthStatus{Status: health.HealthStatusRunning}),
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, printResults(&buf, OutputJSON, results))
+	var printed []map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &printed))
+	require.Len(t, printed, 2)
+	assert.Equal(t, "Pending", printed[0]["status"])
+	assert.Equal(t, "Running", printed[1]["status"])
+}
+
+func TestPrintSingleResult(t *testing.T) {
+	objects, err := readObjects(strings.NewReader(`{"kind": "Pod", "metadata": {"name": "a"}}`))
+	require.NoError(t, err)
+	results := []result{newResult(objects[0], &health.HealthStatus{Status: health.HealthStatusRunning})}
+
+	// json and yaml print the same document for a single object
+	var jsonOut, yamlOut bytes.Buffer
+	require.NoError(t, printResults(&jsonOut, OutputJSON, results))
+	require.NoError(t, printResults(&yamlOut, OutputYAML, results))
+	converted, err := yaml.YAMLToJSON(yamlOut.Bytes())
+	require.NoError(t, err)
+	assert.JSONEq(t, jsonOut.String(), string(converted))
+}
@@ -1,16 +1,14 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"os"
 	"strings"
 
 	"github.com/flanksource/is-healthy/pkg/health"
 	"github.com/flanksource/is-healthy/pkg/lua"
 	"github.com/spf13/cobra"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/yaml"
 )
 
@@ -20,7 +18,16 @@ var (
 	date    = "unknown"
 )
 
-var jsonOut bool
+var (
+	jsonOut           bool
+	statusMapFiles    []string
+	customizationDirs []string
+	watch             bool
+	argoCDConfigMap   string
+
+	// overrides are the resource customizations of the --argocd-cm ConfigMap
+	overrides = lua.ResourceHealthOverrides{}
+)
 
 func main() {
 	if len(commit) > 8 {
@@ -29,36 +36,41 @@ func main() {
 
 	root := &cobra.Command{
 		Use: "is-healthy",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := loadCustomizations(cmd.Context(), customizationDirs, watch); err != nil {
+				return err
+			}
+			var err error
+			if overrides, err = loadArgoCDConfigMap(argoCDConfigMap); err != nil {
+				return err
+			}
+			health.DefaultOverrides = overrides
+			return loadStatusMaps(statusMapFiles)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			stdin, err := io.ReadAll(os.Stdin)
+			objects, err := readObjects(os.Stdin)
 			if err != nil {
 				return err
 			}
+			if len(objects) == 0 {
+				return fmt.Errorf("no objects found in input")
+			}
 
-			obj := make(map[string]interface{})
-			err = yaml.Unmarshal([]byte(stdin), &obj)
+			format, err := getOutputFormat()
 			if err != nil {
 				return err
 			}
 
-			_health, err := health.GetResourceHealth(&unstructured.Unstructured{Object: obj}, lua.ResourceHealthOverrides{})
+			results, err := evaluate(objects)
 			if err != nil {
 				return err
 			}
 
-			if jsonOut {
-				data, _ := json.MarshalIndent(_health, "", "  ")
-				fmt.Println(string(data))
-			} else {
-				fmt.Printf("%s\n", *_health)
+			if err := printResults(os.Stdout, format, results); err != nil {
+				return err
 			}
 
-			if _health.Health.IsWorseThan(health.HealthUnhealthy) {
-				os.Exit(1)
-			}
-			if _health.Health.IsWorseThan(health.HealthWarning) {
-				os.Exit(2)
-			}
+			exitWithWorstHealth(results)
 			return nil
 		},
 	}
@@ -90,16 +102,110 @@ func main() {
 		},
 	})
 
+	root.AddCommand(newWaitCommand())
+	root.AddCommand(newGetCommand())
+	root.AddCommand(newExplainCommand())
+	root.AddCommand(newDiffCommand())
+	root.AddCommand(newActionsCommand())
+	root.AddCommand(newTestCommand())
+
 	root.SetUsageTemplate(root.UsageTemplate() + fmt.Sprintf("\nversion: %s\n ", version))
 
-	root.Flags().BoolVarP(&jsonOut, "json", "j", false, "Output in json format")
+	root.PersistentFlags().BoolVarP(&jsonOut, "json", "j", false, "Output in json format")
+	root.PersistentFlags().StringVarP(&outputFormat, "output", "o", OutputText,
+		"Output format, one of: "+strings.Join(outputFormats, "|"))
+	root.PersistentFlags().StringArrayVar(&statusMapFiles, "status-map", nil,
+		"Status map file to merge over the built-in status maps, can be repeated")
+	root.PersistentFlags().StringArrayVar(&customizationDirs, "customizations", nil,
+		"Directory or oci:// artifact of <group>/<Kind>/health.lua and actions/ scripts overriding the built-in ones, "+
+			"can be repeated")
+	root.PersistentFlags().BoolVar(&watch, "watch", false,
+		"Reload the --customizations directories when they change, e.g. while running wait")
+	root.PersistentFlags().StringVar(&argoCDConfigMap, "argocd-cm", "",
+		"Argo CD argocd-cm ConfigMap, or resource.customizations YAML, overriding the built-in customizations")
 	if err := root.Execute(); err != nil {
-		if jsonOut {
-			data, _ := json.MarshalIndent(map[string]interface{}{"error": err.Error()}, "", "  ")
-			fmt.Println(string(data))
-		} else {
-			fmt.Println(err)
-		}
+		printError(err)
 		os.Exit(3)
 	}
 }
+
+// loadCustomizations layers the customization directories and OCI artifacts over the built-in ones, the directories
+// are watched for changes until the context is done if watch is set
+func loadCustomizations(ctx context.Context, sources []string, watch bool) ([]*lua.CustomizationsDir, error) {
+	var loaded []*lua.CustomizationsDir
+	for _, source := range sources {
+		if strings.HasPrefix(source, lua.OCIScheme) {
+			artifact, err := lua.LoadCustomizationsOCI(ctx, source)
+			if err != nil {
+				return loaded, err
+			}
+			loaded = append(loaded, artifact)
+			continue
+		}
+
+		dir, err := lua.LoadCustomizationsDir(source)
+		if err != nil {
+			return loaded, err
+		}
+		loaded = append(loaded, dir)
+		if !watch {
+			continue
+		}
+		err = dir.Watch(ctx, func(err error) {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to reload %s: %v\n", source, err)
+			}
+		})
+		if err != nil {
+			return loaded, err
+		}
+	}
+	return loaded, nil
+}
+
+func loadStatusMaps(files []string) error {
+	var docs [][]byte
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, data)
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	return health.LoadStatusMaps(docs...)
+}
+
+// loadArgoCDConfigMap returns the resource customizations of an argocd-cm ConfigMap manifest, or of the YAML of its
+// legacy resource.customizations key
+func loadArgoCDConfigMap(file string) (lua.ResourceHealthOverrides, error) {
+	if file == "" {
+		return lua.ResourceHealthOverrides{}, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest struct {
+		Kind string `json:"kind"`
+	}
+	var customizations lua.ResourceHealthOverrides
+	if yaml.Unmarshal(data, &manifest) == nil && manifest.Kind == "ConfigMap" {
+		var configMap struct {
+			Data map[string]string `json:"data"`
+		}
+		if err := yaml.Unmarshal(data, &configMap); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		customizations, err = lua.ParseArgoCDConfigMap(configMap.Data)
+	} else {
+		customizations, err = lua.ParseArgoCDResourceCustomizations(string(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return customizations, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	OutputText    = "text"
+	OutputJSON    = "json"
+	OutputYAML    = "yaml"
+	OutputNDJSON  = "ndjson"
+	OutputTable   = "table"
+	OutputSummary = "summary"
+)
+
+var outputFormats = []string{OutputText, OutputJSON, OutputYAML, OutputNDJSON, OutputTable, OutputSummary}
+
+var outputFormat string
+
+// getOutputFormat returns the selected --output, honoring the legacy --json flag
+func getOutputFormat() (string, error) {
+	if jsonOut {
+		return OutputJSON, nil
+	}
+	if outputFormat == "" {
+		return OutputText, nil
+	}
+	if !lo.Contains(outputFormats, outputFormat) {
+		return "", fmt.Errorf("unsupported output format %q, must be one of: %s",
+			outputFormat, strings.Join(outputFormats, ", "))
+	}
+	return outputFormat, nil
+}
+
+func printResults(w io.Writer, format string, results []result) error {
+	switch format {
+	case OutputJSON:
+		return printJSON(w, results)
+	case OutputYAML:
+		data, err := yaml.Marshal(printable(results))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case OutputNDJSON:
+		encoder := json.NewEncoder(w)
+		for _, r := range results {
+			if err := encoder.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case OutputTable:
+		return printTable(w, results)
+	case OutputSummary:
+		return printSummary(w, results)
+	default:
+		return printText(w, results)
+	}
+}
+
+func printText(w io.Writer, results []result) error {
+	// a single object keeps the original output format
+	if len(results) == 1 {
+		_, err := fmt.Fprintf(w, "%s\n", *results[0].HealthStatus)
+		return err
+	}
+	for _, r := range results {
+		if _, err := fmt.Fprintf(w, "%s: %s\n", r.Key, *r.HealthStatus); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printable returns the health of a single object as is and multiple objects as an array, the input can contain the
+// same object more than once (e.g. several snapshots) so the results are not keyed by object
+func printable(results []result) any {
+	if len(results) == 1 {
+		return results[0].HealthStatus
+	}
+	return results
+}
+
+func printJSON(w io.Writer, results []result) error {
+	data, err := json.MarshalIndent(printable(results), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+func printTable(w io.Writer, results []result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAMESPACE\tNAME\tHEALTH\tSTATUS\tREADY\tLAST UPDATED\tMESSAGE")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%t\t%s\t%s\n",
+			r.Kind,
+			r.Namespace,
+			r.Name,
+			r.Health,
+			r.Status,
+			r.Ready,
+			age(r.LastUpdated),
+			strings.Join(strings.Fields(r.Message), " "),
+		)
+	}
+	return tw.Flush()
+}
+
+func age(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(*t))
+}
+
+func printSummary(w io.Writer, results []result) error {
+	byHealth := make(map[health.Health]int)
+	byStatus := make(map[health.HealthStatusCode]int)
+	for _, r := range results {
+		byHealth[r.Health]++
+		byStatus[r.Status]++
+	}
+
+	healths := lo.Keys(byHealth)
+	// worst first
+	sort.Slice(healths, func(i, j int) bool {
+		return healths[i].CompareTo(healths[j]) > 0
+	})
+
+	statuses := lo.Keys(byStatus)
+	sort.Slice(statuses, func(i, j int) bool {
+		if byStatus[statuses[i]] != byStatus[statuses[j]] {
+			return byStatus[statuses[i]] > byStatus[statuses[j]]
+		}
+		return statuses[i] < statuses[j]
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "HEALTH\tCOUNT")
+	for _, h := range healths {
+		fmt.Fprintf(tw, "%s\t%d\n", lo.CoalesceOrEmpty(string(h), "<none>"), byHealth[h])
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "STATUS\tCOUNT")
+	for _, s := range statuses {
+		fmt.Fprintf(tw, "%s\t%d\n", lo.CoalesceOrEmpty(string(s), "<none>"), byStatus[s])
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "TOTAL\t%d\n", len(results))
+	return tw.Flush()
+}
+
+func printError(err error) {
+	format, _ := getOutputFormat()
+	switch format {
+	case OutputJSON:
+		data, _ := json.MarshalIndent(map[string]any{"error": err.Error()}, "", "  ")
+		fmt.Println(string(data))
+	case OutputNDJSON:
+		data, _ := json.Marshal(map[string]any{"error": err.Error()})
+		fmt.Println(string(data))
+	default:
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Package cluster evaluates the health of objects read directly from a live Kubernetes cluster.
+*/
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/flanksource/is-healthy/pkg/lua"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Client lists objects through a dynamic client and evaluates their health
+type Client struct {
+	Dynamic   dynamic.Interface
+	Mapper    meta.RESTMapper
+	Overrides lua.ResourceHealthOverrides
+}
+
+// Query selects the objects to evaluate, Kind accepts anything kubectl does, e.g. `Deployment`, `deploy`,
+// `deployments.apps` or `deployments.v1.apps`
+type Query struct {
+	Kind          string
+	Name          string
+	Namespace     string
+	AllNamespaces bool
+	LabelSelector string
+}
+
+type Result struct {
+	Object *unstructured.Unstructured
+	Health *health.HealthStatus
+}
+
+// NewClientFromKubeconfig builds a client using the standard kubeconfig loading rules, an empty kubeconfig
+// path uses $KUBECONFIG or ~/.kube/config
+func NewClientFromKubeconfig(kubeconfig, context string) (*Client, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{
+		CurrentContext: context,
+	})
+
+	namespace, _, err := config.Namespace()
+	if err != nil {
+		return nil, "", err
+	}
+
+	restConfig, err := config.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, "", err
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, "", err
+	}
+	cached := memory.NewMemCacheClient(discoveryClient)
+	mapper := restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(cached), cached)
+
+	return &Client{
+		Dynamic:   dynamicClient,
+		Mapper:    mapper,
+		Overrides: lua.ResourceHealthOverrides{},
+	}, namespace, nil
+}
+
+// ResolveKind maps a kind, resource or short name to its REST mapping
+func (c *Client) ResolveKind(kind string) (*meta.RESTMapping, error) {
+	fullySpecified, groupResource := schema.ParseResourceArg(strings.ToLower(kind))
+
+	var gvk schema.GroupVersionKind
+	var err error
+	if fullySpecified != nil {
+		gvk, err = c.Mapper.KindFor(*fullySpecified)
+	}
+	if gvk.Empty() {
+		gvk, err = c.Mapper.KindFor(groupResource.WithVersion(""))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unknown resource type %q: %w", kind, err)
+	}
+
+	return c.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+// Get lists the objects matching the query and returns the health of each
+func (c *Client) Get(ctx context.Context, query Query) ([]Result, error) {
+	mapping, err := c.ResolveKind(query.Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	var resource dynamic.ResourceInterface = c.Dynamic.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace && !query.AllNamespaces {
+		resource = c.Dynamic.Resource(mapping.Resource).Namespace(query.Namespace)
+	}
+
+	var objects []unstructured.Unstructured
+	if query.Name != "" {
+		obj, err := resource.Get(ctx, query.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, *obj)
+	} else {
+		list, err := resource.List(ctx, metav1.ListOptions{LabelSelector: query.LabelSelector})
+		if err != nil {
+			return nil, err
+		}
+		objects = list.Items
+	}
+
+	var results []Result
+	for i := range objects {
+		obj := &objects[i]
+		// list items omit the apiVersion/kind that the health checks rely on
+		obj.SetGroupVersionKind(mapping.GroupVersionKind)
+		hr, err := health.GetResourceHealthWithOptions(obj, health.Options{Override: c.Overrides, Endpoints: c})
+		if hr == nil && err != nil {
+			hr = &health.HealthStatus{
+				Health:  health.HealthUnknown,
+				Status:  health.HealthStatusUnknown,
+				Message: err.Error(),
+			}
+		}
+		results = append(results, Result{Object: obj, Health: hr})
+	}
+	return results, nil
+}
+
+// GetEndpoints returns the EndpointSlices of a Service, implementing health.EndpointLookup
+func (c *Client) GetEndpoints(namespace, service string) ([]*unstructured.Unstructured, error) {
+	list, err := c.Dynamic.Resource(discoveryv1.SchemeGroupVersion.WithResource("endpointslices")).
+		Namespace(namespace).
+		List(context.TODO(), metav1.ListOptions{LabelSelector: discoveryv1.LabelServiceName + "=" + service})
+	if err != nil {
+		return nil, err
+	}
+	var slices []*unstructured.Unstructured
+	for i := range list.Items {
+		slice := &list.Items[i]
+		slice.SetGroupVersionKind(discoveryv1.SchemeGroupVersion.WithKind(health.EndpointSliceKind))
+		slices = append(slices, slice)
+	}
+	return slices, nil
+}
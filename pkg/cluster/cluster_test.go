@@ -0,0 +1,126 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/flanksource/is-healthy/pkg/lua"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+var (
+	podGVK       = schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	namespaceGVK = schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}
+	jobGVK       = schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}
+	serviceGVK   = schema.GroupVersionKind{Version: "v1", Kind: "Service"}
+	sliceGVK     = schema.GroupVersionKind{Group: "discovery.k8s.io", Version: "v1", Kind: "EndpointSlice"}
+)
+
+func newObject(gvk schema.GroupVersionKind, namespace, name string, status map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{"status": status}}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func newFakeClient(objects ...runtime.Object) *Client {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(podGVK, meta.RESTScopeNamespace)
+	mapper.Add(jobGVK, meta.RESTScopeNamespace)
+	mapper.Add(namespaceGVK, meta.RESTScopeRoot)
+	mapper.Add(serviceGVK, meta.RESTScopeNamespace)
+
+	listKinds := map[schema.GroupVersionResource]string{
+		{Version: "v1", Resource: "pods"}:                                      "PodList",
+		{Version: "v1", Resource: "namespaces"}:                                "NamespaceList",
+		{Group: "batch", Version: "v1", Resource: "jobs"}:                      "JobList",
+		{Version: "v1", Resource: "services"}:                                  "ServiceList",
+		{Group: "discovery.k8s.io", Version: "v1", Resource: "endpointslices"}: "EndpointSliceList",
+	}
+
+	return &Client{
+		Dynamic:   dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...),
+		Mapper:    mapper,
+		Overrides: lua.ResourceHealthOverrides{},
+	}
+}
+
+func TestGet(t *testing.T) {
+	client := newFakeClient(
+		newObject(jobGVK, "default", "complete", map[string]any{
+			"conditions": []any{map[string]any{"type": "Complete", "status": "True"}},
+		}),
+		newObject(jobGVK, "default", "failed", map[string]any{
+			"conditions": []any{map[string]any{"type": "Failed", "status": "True", "reason": "BackoffLimitExceeded"}},
+		}),
+		newObject(jobGVK, "other", "running", map[string]any{}),
+		newObject(namespaceGVK, "", "default", map[string]any{"phase": "Active"}),
+	)
+
+	t.Run("namespaced list", func(t *testing.T) {
+		results, err := client.Get(context.Background(), Query{Kind: "jobs", Namespace: "default"})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+
+		byName := map[string]*health.HealthStatus{}
+		for _, r := range results {
+			assert.Equal(t, "Job", r.Object.GetKind())
+			byName[r.Object.GetName()] = r.Health
+		}
+		assert.Equal(t, health.HealthHealthy, byName["complete"].Health)
+		assert.Equal(t, health.HealthUnhealthy, byName["failed"].Health)
+		assert.Equal(t, health.HealthStatusCode("BackoffLimitExceeded"), byName["failed"].Status)
+	})
+
+	t.Run("all namespaces", func(t *testing.T) {
+		results, err := client.Get(context.Background(), Query{Kind: "Job", AllNamespaces: true})
+		require.NoError(t, err)
+		assert.Len(t, results, 3)
+	})
+
+	t.Run("by name", func(t *testing.T) {
+		results, err := client.Get(context.Background(), Query{Kind: "job.batch", Namespace: "other", Name: "running"})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, health.HealthStatusRunning, results[0].Health.Status)
+	})
+
+	t.Run("cluster scoped", func(t *testing.T) {
+		results, err := client.Get(context.Background(), Query{Kind: "namespace", Namespace: "ignored"})
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, health.HealthStatusHealthy, results[0].Health.Status)
+	})
+
+	t.Run("unknown kind", func(t *testing.T) {
+		_, err := client.Get(context.Background(), Query{Kind: "widgets"})
+		assert.Error(t, err)
+	})
+}
+
+func TestGetServiceEndpoints(t *testing.T) {
+	service := newObject(serviceGVK, "default", "nginx", map[string]any{})
+	service.Object["spec"] = map[string]any{"type": "ClusterIP", "selector": map[string]any{"app": "nginx"}}
+	slice := newObject(sliceGVK, "default", "nginx-abcde", nil)
+	slice.SetLabels(map[string]string{"kubernetes.io/service-name": "nginx"})
+	slice.Object["addressType"] = "IPv4"
+	slice.Object["endpoints"] = []any{
+		map[string]any{"addresses": []any{"10.0.0.1"}, "conditions": map[string]any{"ready": true}},
+		map[string]any{"addresses": []any{"10.0.0.2"}, "conditions": map[string]any{"ready": false}},
+	}
+	client := newFakeClient(service, slice)
+
+	results, err := client.Get(context.Background(), Query{Kind: "services", Namespace: "default"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, health.HealthHealthy, results[0].Health.Health)
+	assert.Equal(t, "1/2 endpoints ready", results[0].Health.Message)
+}
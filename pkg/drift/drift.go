@@ -0,0 +1,210 @@
+/*
+Package drift compares a desired manifest with the live object, honoring the ignoreDifferences rules of the
+resource customizations.
+*/
+package drift
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/flanksource/is-healthy/pkg/lua"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	HealthStatusSynced    health.HealthStatusCode = "Synced"
+	HealthStatusOutOfSync health.HealthStatusCode = "OutOfSync"
+)
+
+type ChangeType string
+
+const (
+	// ChangeModified is a field with a different value in the live object
+	ChangeModified ChangeType = "modified"
+	// ChangeMissing is a field of the desired manifest that is not in the live object
+	ChangeMissing ChangeType = "missing"
+	// ChangeExtra is a list item of the live object that is not in the desired manifest
+	ChangeExtra ChangeType = "extra"
+)
+
+// Change is a single difference between the desired and live object
+type Change struct {
+	// Path is a JSON pointer to the field
+	Path    string     `json:"path"              yaml:"path"`
+	Type    ChangeType `json:"type"              yaml:"type"`
+	Desired any        `json:"desired,omitempty" yaml:"desired,omitempty"`
+	Live    any        `json:"live,omitempty"    yaml:"live,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Type {
+	case ChangeMissing:
+		return fmt.Sprintf("%s: missing, expected %v", c.Path, c.Desired)
+	case ChangeExtra:
+		return fmt.Sprintf("%s: unexpected %v", c.Path, c.Live)
+	default:
+		return fmt.Sprintf("%s: %v != %v", c.Path, c.Desired, c.Live)
+	}
+}
+
+// Result is the sync status of an object, Health is warning and Status OutOfSync when any field differs
+type Result struct {
+	health.HealthStatus `json:",inline" yaml:",inline"`
+
+	Changes []Change `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+// ignoredFields are populated by the API server and never part of a desired manifest
+var ignoredFields = [][]string{
+	{"status"},
+	{"metadata", "managedFields"},
+	{"metadata", "resourceVersion"},
+	{"metadata", "uid"},
+	{"metadata", "generation"},
+	{"metadata", "creationTimestamp"},
+	{"metadata", "selfLink"},
+	{"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration"},
+}
+
+// Diff compares the desired manifest with the live object using the ignoreDifferences of the overrides
+// matching the object's group/kind. Fields that are only set on the live object are assumed to be defaulted
+// by the API server and are not reported, except for extra list items.
+func Diff(desired, live *unstructured.Unstructured, overrides lua.ResourceHealthOverrides) (*Result, error) {
+	return DiffWithRules(desired, live, overrides.GetIgnoreDifferences(desired.GroupVersionKind())...)
+}
+
+// DiffWithRules compares the desired manifest with the live object ignoring the fields matched by the rules
+func DiffWithRules(desired, live *unstructured.Unstructured, rules ...lua.OverrideIgnoreDiff) (*Result, error) {
+	if desired.GroupVersionKind().GroupKind() != live.GroupVersionKind().GroupKind() {
+		return nil, fmt.Errorf("cannot compare %s with %s",
+			desired.GroupVersionKind().GroupKind(), live.GroupVersionKind().GroupKind())
+	}
+
+	desired, live = desired.DeepCopy(), live.DeepCopy()
+	for _, rule := range rules {
+		if err := applyIgnoreRule(rule, desired, live); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, fields := range ignoredFields {
+		unstructured.RemoveNestedField(desired.Object, fields...)
+		unstructured.RemoveNestedField(live.Object, fields...)
+	}
+
+	var changes []Change
+	compare("", desired.Object, live.Object, &changes)
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	result := &Result{
+		HealthStatus: health.HealthStatus{
+			Ready:  true,
+			Health: health.HealthHealthy,
+			Status: HealthStatusSynced,
+		},
+		Changes: changes,
+	}
+	if len(changes) > 0 {
+		result.Health = health.HealthWarning
+		result.Status = HealthStatusOutOfSync
+		result.Message = summarize(changes)
+	}
+	return result, nil
+}
+
+func summarize(changes []Change) string {
+	const maxPaths = 3
+	var paths []string
+	for i, c := range changes {
+		if i == maxPaths {
+			paths = append(paths, fmt.Sprintf("and %d more", len(changes)-maxPaths))
+			break
+		}
+		paths = append(paths, c.Path)
+	}
+	noun := "fields differ"
+	if len(changes) == 1 {
+		noun = "field differs"
+	}
+	return fmt.Sprintf("%d %s: %s", len(changes), noun, strings.Join(paths, ", "))
+}
+
+func compare(path string, desired, live any, changes *[]Change) {
+	switch d := desired.(type) {
+	case map[string]any:
+		l, ok := live.(map[string]any)
+		if !ok {
+			*changes = append(*changes, mismatch(path, desired, live))
+			return
+		}
+		for k, v := range d {
+			lv, exists := l[k]
+			if !exists {
+				if v != nil {
+					*changes = append(*changes, Change{Path: pointer(path, k), Type: ChangeMissing, Desired: v})
+				}
+				continue
+			}
+			compare(pointer(path, k), v, lv, changes)
+		}
+	case []any:
+		l, ok := live.([]any)
+		if !ok {
+			*changes = append(*changes, mismatch(path, desired, live))
+			return
+		}
+		for i, v := range d {
+			if i >= len(l) {
+				*changes = append(*changes,
+					Change{Path: pointer(path, strconv.Itoa(i)), Type: ChangeMissing, Desired: v})
+				continue
+			}
+			compare(pointer(path, strconv.Itoa(i)), v, l[i], changes)
+		}
+		for i := len(d); i < len(l); i++ {
+			*changes = append(*changes, Change{Path: pointer(path, strconv.Itoa(i)), Type: ChangeExtra, Live: l[i]})
+		}
+	default:
+		if !equalScalar(desired, live) {
+			*changes = append(*changes, mismatch(path, desired, live))
+		}
+	}
+}
+
+func mismatch(path string, desired, live any) Change {
+	if live == nil {
+		return Change{Path: path, Type: ChangeMissing, Desired: desired}
+	}
+	return Change{Path: path, Type: ChangeModified, Desired: desired, Live: live}
+}
+
+func equalScalar(a, b any) bool {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return x == y
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// pointer appends an escaped RFC 6901 reference token to a JSON pointer
+func pointer(path, token string) string {
+	return path + "/" + strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
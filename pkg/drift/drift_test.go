@@ -0,0 +1,156 @@
+package drift_test
+
+import (
+	"testing"
+
+	"github.com/flanksource/is-healthy/pkg/drift"
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/flanksource/is-healthy/pkg/lua"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const desiredDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  namespace: default
+  annotations:
+    owner: platform
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.25
+`
+
+const liveDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  namespace: default
+  uid: 9f2b1c1e-1111-2222-3333-444455556666
+  resourceVersion: "1234"
+  generation: 4
+  annotations:
+    owner: platform
+    deployment.kubernetes.io/revision: "3"
+  managedFields:
+  - manager: kubectl
+    operation: Apply
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:spec:
+        f:template:
+          f:spec:
+            f:containers:
+              k:{"name":"nginx"}:
+                f:image: {}
+  - manager: hpa-controller
+    operation: Update
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:spec:
+        f:replicas: {}
+spec:
+  replicas: 5
+  progressDeadlineSeconds: 600
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.24
+        imagePullPolicy: IfNotPresent
+      - name: istio-proxy
+        image: istio/proxyv2:1.20
+status:
+  readyReplicas: 5
+`
+
+func parse(t *testing.T, doc string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	require.NoError(t, yaml.Unmarshal([]byte(doc), &obj.Object))
+	return obj
+}
+
+func paths(r *drift.Result) []string {
+	return lo.Map(r.Changes, func(c drift.Change, _ int) string { return c.Path })
+}
+
+func TestDiff(t *testing.T) {
+	desired, live := parse(t, desiredDeployment), parse(t, liveDeployment)
+
+	r, err := drift.DiffWithRules(desired, live)
+	require.NoError(t, err)
+	assert.Equal(t, drift.HealthStatusOutOfSync, r.Status)
+	assert.Equal(t, health.HealthWarning, r.Health)
+	assert.Equal(t, []string{
+		"/spec/replicas",
+		"/spec/template/spec/containers/0/image",
+		"/spec/template/spec/containers/1",
+	}, paths(r))
+	assert.Equal(t, drift.ChangeModified, r.Changes[0].Type)
+	assert.Equal(t, drift.ChangeExtra, r.Changes[2].Type)
+	assert.Equal(t,
+		"3 fields differ: /spec/replicas, /spec/template/spec/containers/0/image, /spec/template/spec/containers/1",
+		r.Message)
+
+	t.Run("json pointers and jq paths", func(t *testing.T) {
+		r, err := drift.DiffWithRules(desired, live, lua.OverrideIgnoreDiff{
+			JSONPointers: []string{"/spec/replicas"},
+			JQPathExpressions: []string{
+				`.spec.template.spec.containers[] | select(.name == "istio-proxy")`,
+				`.spec.template.spec.containers[] | select(.name == "nginx") | .image`,
+			},
+		})
+		require.NoError(t, err)
+		assert.Empty(t, r.Changes)
+		assert.Equal(t, drift.HealthStatusSynced, r.Status)
+		assert.Equal(t, health.HealthHealthy, r.Health)
+	})
+
+	t.Run("managed fields managers", func(t *testing.T) {
+		r, err := drift.DiffWithRules(desired, live, lua.OverrideIgnoreDiff{
+			ManagedFieldsManagers: []string{"hpa-controller", "kubectl"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"/spec/template/spec/containers/1"}, paths(r))
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		r, err := drift.Diff(desired, live, lua.ResourceHealthOverrides{
+			"apps/*": lua.ResourceOverride{IgnoreDifferences: lua.OverrideIgnoreDiff{
+				JQPathExpressions: []string{".spec.template.spec.containers[1]", ".spec.replicas"},
+			}},
+			"batch/Job": lua.ResourceOverride{IgnoreDifferences: lua.OverrideIgnoreDiff{
+				JSONPointers: []string{"/spec"},
+			}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"/spec/template/spec/containers/0/image"}, paths(r))
+	})
+
+	t.Run("missing fields", func(t *testing.T) {
+		live := live.DeepCopy()
+		unstructured.RemoveNestedField(live.Object, "metadata", "annotations", "owner")
+		r, err := drift.DiffWithRules(desired, live, lua.OverrideIgnoreDiff{JSONPointers: []string{"/spec"}})
+		require.NoError(t, err)
+		require.Len(t, r.Changes, 1)
+		expected := drift.Change{Path: "/metadata/annotations/owner", Type: drift.ChangeMissing, Desired: "platform"}
+		assert.Equal(t, expected, r.Changes[0])
+	})
+
+	t.Run("invalid rules", func(t *testing.T) {
+		_, err := drift.DiffWithRules(desired, live, lua.OverrideIgnoreDiff{JSONPointers: []string{"spec"}})
+		assert.Error(t, err)
+		_, err = drift.DiffWithRules(desired, live, lua.OverrideIgnoreDiff{JQPathExpressions: []string{".spec | keys"}})
+		assert.Error(t, err)
+	})
+}
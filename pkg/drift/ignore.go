@@ -0,0 +1,193 @@
+package drift
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/flanksource/is-healthy/pkg/lua"
+	"github.com/itchyny/gojq"
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/value"
+)
+
+func applyIgnoreRule(rule lua.OverrideIgnoreDiff, objs ...*unstructured.Unstructured) error {
+	for _, ptr := range rule.JSONPointers {
+		tokens, err := parsePointer(ptr)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			obj.Object, _ = removePath(obj.Object, tokens).(map[string]any)
+		}
+	}
+
+	for _, expr := range rule.JQPathExpressions {
+		code, err := compileJQDeletion(expr)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			if obj.Object, err = runJQDeletion(code, expr, obj.Object); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(rule.ManagedFieldsManagers) > 0 {
+		// the live object is the last one, it is the only one with up to date managed fields
+		live := objs[len(objs)-1]
+		for _, managed := range live.GetManagedFields() {
+			if !lo.Contains(rule.ManagedFieldsManagers, managed.Manager) || managed.FieldsV1 == nil {
+				continue
+			}
+			set := &fieldpath.Set{}
+			if err := set.FromJSON(bytes.NewReader(managed.FieldsV1.Raw)); err != nil {
+				return fmt.Errorf("failed to parse the managed fields of %s: %w", managed.Manager, err)
+			}
+			set.Leaves().Iterate(func(path fieldpath.Path) {
+				for _, obj := range objs {
+					obj.Object, _ = removeFieldPath(obj.Object, path).(map[string]any)
+				}
+			})
+		}
+	}
+	return nil
+}
+
+// parsePointer parses a RFC 6901 JSON pointer
+func parsePointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, fmt.Errorf("empty JSON pointer")
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q, must start with /", ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// removePath removes the value at path from v, returning the updated v
+func removePath(v any, path []string) any {
+	if len(path) == 0 {
+		return v
+	}
+	switch value := v.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			delete(value, path[0])
+		} else if child, ok := value[path[0]]; ok {
+			value[path[0]] = removePath(child, path[1:])
+		}
+	case []any:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= len(value) {
+			return v
+		}
+		if len(path) == 1 {
+			return append(value[:i:i], value[i+1:]...)
+		}
+		value[i] = removePath(value[i], path[1:])
+	}
+	return v
+}
+
+// removeFieldPath removes a path of managed fields from v, returning the updated v
+func removeFieldPath(v any, path fieldpath.Path) any {
+	if len(path) == 0 {
+		return v
+	}
+	element, last := path[0], len(path) == 1
+
+	if element.FieldName != nil {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return v
+		}
+		if last {
+			delete(m, *element.FieldName)
+		} else if child, ok := m[*element.FieldName]; ok {
+			m[*element.FieldName] = removeFieldPath(child, path[1:])
+		}
+		return v
+	}
+
+	list, ok := v.([]any)
+	if !ok {
+		return v
+	}
+	for i := 0; i < len(list); i++ {
+		if !matchesPathElement(element, i, list[i]) {
+			continue
+		}
+		if last {
+			return append(list[:i:i], list[i+1:]...)
+		}
+		list[i] = removeFieldPath(list[i], path[1:])
+	}
+	return list
+}
+
+func matchesPathElement(element fieldpath.PathElement, index int, item any) bool {
+	switch {
+	case element.Index != nil:
+		return *element.Index == index
+	case element.Value != nil:
+		return value.Equals(*element.Value, value.NewValueInterface(item))
+	case element.Key != nil:
+		m, ok := item.(map[string]any)
+		if !ok {
+			return false
+		}
+		for _, field := range *element.Key {
+			v, ok := m[field.Name]
+			if !ok || !value.Equals(field.Value, value.NewValueInterface(v)) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compileJQDeletion compiles a jq path expression into a query deleting the paths it selects, as Argo CD does
+func compileJQDeletion(expr string) (*gojq.Code, error) {
+	query, err := gojq.Parse(fmt.Sprintf("del(%s)", expr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq path %q: %w", expr, err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq path %q: %w", expr, err)
+	}
+	return code, nil
+}
+
+func runJQDeletion(code *gojq.Code, expr string, obj map[string]any) (map[string]any, error) {
+	// gojq normalizes the numbers of its input in place, it runs on a copy converted back to unstructured numbers
+	result, ok := code.Run(runtime.DeepCopyJSON(obj)).Next()
+	if !ok {
+		return obj, nil
+	}
+	if err, ok := result.(error); ok {
+		return nil, fmt.Errorf("failed to apply jq path %q: %w", expr, err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	var updated map[string]any
+	if err := utiljson.Unmarshal(data, &updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
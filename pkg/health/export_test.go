@@ -0,0 +1,16 @@
+package health
+
+import "maps"
+
+// SnapshotStatusMaps returns a func that restores the status maps loaded at the time of the snapshot, tests that
+// load status maps use it with t.Cleanup so that the maps do not leak into other tests
+func SnapshotStatusMaps() (restore func()) {
+	statusByKindLock.RLock()
+	snapshot := maps.Clone(statusByKind)
+	statusByKindLock.RUnlock()
+	return func() {
+		statusByKindLock.Lock()
+		defer statusByKindLock.Unlock()
+		statusByKind = snapshot
+	}
+}
@@ -0,0 +1,100 @@
+package health
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+)
+
+// Expressions are used by the `expr` field of status map filters and conditions, they are CEL expressions
+// (https://github.com/google/cel-spec) that must evaluate to a bool, e.g.
+//
+//	status.readyReplicas < spec.replicas && !has(status.conditions)
+//	metadata.labels["app.kubernetes.io/managed-by"] == "Helm" || status.phase.matches("^(Failed|Unknown)$")
+//	status.conditions.exists(c, c.type == "Stalled" && c.status == "True")
+//
+// The top level fields of the object (apiVersion, kind, metadata, spec, status...) are variables, and conditions
+// can also reference the condition being mapped using `condition.type`, `condition.status`, `condition.reason` and
+// `condition.message`. Values are not converted, a string holding a number has to be converted with int() or
+// double(). Referencing a missing field is an evaluation error, use has() or the optional syntax, e.g.
+// `status.?readyReplicas.orValue(0)`, for fields that can be omitted.
+
+var (
+	expressionEnv     *cel.Env
+	expressionEnvErr  error
+	expressionEnvOnce sync.Once
+	expressionCache   sync.Map
+)
+
+func getExpressionEnv() (*cel.Env, error) {
+	expressionEnvOnce.Do(func() {
+		expressionEnv, expressionEnvErr = cel.NewEnv(
+			cel.OptionalTypes(),
+			cel.CrossTypeNumericComparisons(true),
+			ext.Strings(),
+		)
+	})
+	return expressionEnv, expressionEnvErr
+}
+
+// EvalExpression evaluates a status map expression against vars, an invalid expression, an expression that fails to
+// evaluate or that does not evaluate to a bool returns an error
+func EvalExpression(expr string, vars map[string]any) (bool, error) {
+	program, err := compileExpression(expr)
+	if err != nil {
+		return false, err
+	}
+	return evalProgram(expr, program, vars)
+}
+
+// matchExpression evaluates a status map expression, an expression that fails to evaluate (e.g. because it
+// references a missing field) does not match and the failure is recorded in the trace
+func matchExpression(expr string, vars map[string]any, t *tracer, source string) (bool, error) {
+	program, err := compileExpression(expr)
+	if err != nil {
+		return false, err
+	}
+	matched, err := evalProgram(expr, program, vars)
+	if err != nil {
+		t.add(source, "%v", err)
+		return false, nil
+	}
+	return matched, nil
+}
+
+func compileExpression(expr string) (cel.Program, error) {
+	if cached, ok := expressionCache.Load(expr); ok {
+		return cached.(cel.Program), nil
+	}
+
+	env, err := getExpressionEnv()
+	if err != nil {
+		return nil, err
+	}
+	// the expressions are parsed but not checked, the variables are the fields of an arbitrary object
+	ast, issues := env.Parse(expr)
+	if issues.Err() != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", expr, issues.Err())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", expr, err)
+	}
+
+	expressionCache.Store(expr, program)
+	return program, nil
+}
+
+func evalProgram(expr string, program cel.Program, vars map[string]any) (bool, error) {
+	out, _, err := program.Eval(vars)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate %q: %w", expr, err)
+	}
+	matched, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("%q evaluated to %v, not a bool", expr, out.Value())
+	}
+	return matched, nil
+}
@@ -0,0 +1,74 @@
+package health_test
+
+import (
+	"testing"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalExpression(t *testing.T) {
+	obj := map[string]any{
+		"metadata": map[string]any{
+			"generation": int64(3),
+			"labels":     map[string]any{"app.kubernetes.io/managed-by": "Helm"},
+		},
+		"spec": map[string]any{"replicas": int64(3), "paused": false},
+		"status": map[string]any{
+			"readyReplicas":      int64(2),
+			"observedGeneration": int64(3),
+			"phase":              "Failed",
+			"capacity":           "10",
+			"conditions": []any{
+				map[string]any{"type": "Ready", "status": "False"},
+			},
+		},
+	}
+
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{"status.readyReplicas < spec.replicas", true},
+		{"status.readyReplicas >= spec.replicas", false},
+		{"status.observedGeneration == metadata.generation", true},
+		{"int(status.capacity) > 9", true},
+		{"status.capacity == '10'", true},
+		// strings compare lexicographically
+		{"status.capacity < '9'", true},
+		{"has(status.conditions) && size(status.conditions) == 1", true},
+		{"has(status.missing) || !has(spec.template)", true},
+		{"status.?missing.orValue(-1) > -1", false},
+		{`metadata.labels["app.kubernetes.io/managed-by"] == "Helm"`, true},
+		{`status.conditions[0].status == "False"`, true},
+		{`status.conditions.exists(c, c.type == "Ready" && c.status == "False")`, true},
+		{`status.phase.matches("^(Failed|Unknown)$")`, true},
+		{`!(status.phase == "Failed" && spec.paused)`, true},
+		{"spec.paused", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			got, err := health.EvalExpression(tc.expr, obj)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+
+	for _, invalid := range []string{
+		"status.phase ==",
+		"(status.phase",
+		"status.phase = 'x'",
+		`"unterminated`,
+		// evaluation errors
+		"foo(status)",
+		"status.missing > 1",
+		`status.conditions[5].status == "False"`,
+		"status.capacity > 9",
+		"status.phase",
+	} {
+		_, err := health.EvalExpression(invalid, obj)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -121,6 +121,24 @@ const (
 	HealthStatusWarning          HealthStatusCode = "Warning"
 	HealthStatusStopped          HealthStatusCode = "Stopped"
 	HealthStatusStopping         HealthStatusCode = "Stopping"
+	HealthStatusAvailable        HealthStatusCode = "Available"
+	HealthStatusUnavailable      HealthStatusCode = "Unavailable"
+	HealthStatusAccepted         HealthStatusCode = "Accepted"
+	HealthStatusProgrammed       HealthStatusCode = "Programmed"
+	HealthStatusAttached         HealthStatusCode = "Attached"
+	HealthStatusAttaching        HealthStatusCode = "Attaching"
+	HealthStatusAttachError      HealthStatusCode = "Attach Error"
+	HealthStatusDetachError      HealthStatusCode = "Detach Error"
+	// Indicates that the service of an aggregated APIService does not serve the API
+	HealthStatusFailedDiscoveryCheck HealthStatusCode = "FailedDiscoveryCheck"
+	// Indicates that no pod backs the service of an aggregated APIService
+	HealthStatusMissingEndpoints HealthStatusCode = "MissingEndpoints"
+	// Indicates that a Service with a selector does not select any pod
+	HealthStatusNoEndpoints HealthStatusCode = "No Endpoints"
+	// Indicates that none of the pods selected by a Service are ready
+	HealthStatusNoReadyEndpoints HealthStatusCode = "No Ready Endpoints"
+	// Indicates that the health script exceeded its resource limits, e.g. a timeout
+	HealthStatusBudgetExceeded HealthStatusCode = "BudgetExceeded"
 )
 
 // Implements custom health assessment that overrides built-in assessment
@@ -128,6 +146,18 @@ type HealthOverride interface {
 	GetResourceHealth(obj *unstructured.Unstructured) (*HealthStatus, error)
 }
 
+// HealthOverrideAt is implemented by overrides that can evaluate the health as of a given time, it is used
+// instead of GetResourceHealth when Options.Now is set
+type HealthOverrideAt interface {
+	GetResourceHealthAt(obj *unstructured.Unstructured, now time.Time) (*HealthStatus, error)
+}
+
+// HealthOverrideSource is implemented by overrides that can name the script they evaluate for an object, e.g. the
+// path of a lua script, it is recorded in the trace of an evaluation
+type HealthOverrideSource interface {
+	HealthSource(obj *unstructured.Unstructured) string
+}
+
 func get(obj map[string]any, keys ...string) string {
 	v, _, _ := unstructured.NestedString(obj, keys...)
 	return strings.TrimSpace(v)
@@ -138,6 +168,17 @@ func isArgoHealth(s HealthStatusCode) bool {
 }
 
 func GetHealthByConfigType(configType string, obj map[string]any, states ...string) HealthStatus {
+	return GetHealthByConfigTypeWithOptions(configType, obj, Options{Override: DefaultOverrides}, states...)
+}
+
+// GetHealthByConfigTypeWithOptions returns the health of a config item, the options are used for the Kubernetes
+// resources and their Now for the time dependent health of the other config types
+func GetHealthByConfigTypeWithOptions(
+	configType string,
+	obj map[string]any,
+	opts Options,
+	states ...string,
+) HealthStatus {
 	configClass := strings.Split(configType, "::")[0]
 
 	switch strings.ToLower(configClass) {
@@ -148,9 +189,9 @@ func GetHealthByConfigType(configType string, obj map[string]any, states ...stri
 	case "mongo":
 		return GetMongoHealth(obj)
 	case "azure":
-		return GetAzureHealth(configType, obj)
+		return getAzureHealth(configType, obj, opts.now())
 	case "kubernetes", "crossplane", "missioncontrol", "flux", "argo":
-		hr, err := GetResourceHealth(&unstructured.Unstructured{Object: obj}, DefaultOverrides)
+		hr, err := GetResourceHealthWithOptions(&unstructured.Unstructured{Object: obj}, opts)
 		if hr != nil {
 			return *hr
 		}
@@ -294,14 +335,51 @@ func GetLastUpdatedTime(obj *unstructured.Unstructured) *time.Time {
 	return &lastUpdated
 }
 
+// Options controls how the health of a resource is evaluated
+type Options struct {
+	// Override is used for resources without a built-in health check
+	Override HealthOverride
+	// Trace records the decisions taken during the evaluation in HealthStatus.Trace
+	Trace bool
+	// Now is the time the health is evaluated at, e.g. when re-evaluating a historic snapshot.
+	// Defaults to the current time.
+	Now time.Time
+	// Endpoints are used to evaluate the health of Services from their endpoints, see NewEndpointIndex
+	Endpoints EndpointLookup
+}
+
+func (opts Options) now() time.Time {
+	if opts.Now.IsZero() {
+		return time.Now()
+	}
+	return opts.Now
+}
+
 // GetResourceHealth returns the health of a k8s resource
 func GetResourceHealth(
 	obj *unstructured.Unstructured,
 	healthOverride HealthOverride,
 ) (health *HealthStatus, err error) {
+	return GetResourceHealthWithOptions(obj, Options{Override: healthOverride})
+}
+
+// GetResourceHealthWithOptions returns the health of a k8s resource
+func GetResourceHealthWithOptions(obj *unstructured.Unstructured, opts Options) (health *HealthStatus, err error) {
+	var t *tracer
+	if opts.Trace {
+		t = &tracer{}
+		defer func() {
+			if health != nil {
+				health.Trace = t.steps
+			}
+		}()
+	}
+
+	now := opts.now()
 	if obj.GetDeletionTimestamp() != nil && !obj.GetDeletionTimestamp().IsZero() &&
-		time.Since(obj.GetDeletionTimestamp().Time) > time.Hour {
-		terminatingFor := time.Since(obj.GetDeletionTimestamp().Time)
+		now.Sub(obj.GetDeletionTimestamp().Time) > time.Hour {
+		terminatingFor := now.Sub(obj.GetDeletionTimestamp().Time)
+		t.add(TraceSourceTerminating, "deletionTimestamp is more than 1h ago")
 		return &HealthStatus{
 			Status:      "TerminatingStalled",
 			LastUpdated: GetLastUpdatedTime(obj),
@@ -313,58 +391,98 @@ func GetResourceHealth(
 		}, nil
 	}
 
-	if healthCheck := GetHealthCheckFunc(obj.GroupVersionKind()); healthCheck != nil {
-		if health, err = healthCheck(obj); err != nil {
+	if check := getHealthCheck(obj.GroupVersionKind()); check != nil {
+		name, healthCheck := check.name, check.fn
+		if t != nil && check.traced != nil {
+			healthCheck = func(obj *unstructured.Unstructured, _ Options) (*HealthStatus, error) {
+				return check.traced(obj, t)
+			}
+		}
+		checkOpts := opts
+		checkOpts.Now = now
+		if health, err = healthCheck(obj, checkOpts); err != nil {
+			t.add(TraceSourceGo, "%s failed: %v", name, err)
 			health = &HealthStatus{
 				Status:  HealthStatusUnknown,
 				Message: err.Error(),
 			}
+		} else if health != nil {
+			t.add(TraceSourceGo, "%s returned %s", name, describe(*health))
+		} else {
+			t.add(TraceSourceGo, "%s returned no result", name)
 		}
+	} else {
+		t.add(TraceSourceGo, "no built-in health check for %s", obj.GroupVersionKind())
 	}
 
-	if health == nil && healthOverride != nil {
-		health, err = healthOverride.GetResourceHealth(obj)
+	if health == nil && opts.Override != nil {
+		var source string
+		if override, ok := opts.Override.(HealthOverrideSource); ok && t != nil {
+			source = override.HealthSource(obj)
+		}
+		if source == "" && t != nil {
+			source = fmt.Sprintf("%T", opts.Override)
+		}
+		if override, ok := opts.Override.(HealthOverrideAt); ok && !opts.Now.IsZero() {
+			health, err = override.GetResourceHealthAt(obj, now)
+		} else {
+			health, err = opts.Override.GetResourceHealth(obj)
+		}
 		if err != nil {
+			t.add(TraceSourceOverride, "%s failed: %v", source, err)
 			return &HealthStatus{
 				Status:  HealthStatusUnknown,
 				Message: err.Error(),
 			}, err
 		}
+		if health != nil {
+			t.add(TraceSourceOverride, "%s returned %s", source, describe(*health))
+		} else {
+			t.add(TraceSourceOverride, "%s has no health check for %s", source, obj.GroupVersionKind())
+		}
 	}
 
 	if health == nil ||
 		health.Status == "" ||
 		isArgoHealth(health.Status) {
 		// try and get a better status from conditions
-		defaultHealth, err := GetDefaultHealth(obj)
+		defaultHealth, err := getDefaultHealth(obj, t)
 		if err != nil {
+			t.add(TraceSourceDefault, "failed to parse conditions: %v", err)
 			return &HealthStatus{
 				Status:  "HealthParseError",
 				Message: lo.Elipse(err.Error(), 500),
 			}, nil
 		}
 		if health == nil {
+			t.add(TraceSourceDefault, "using the status map result %s", describe(*defaultHealth))
 			health = defaultHealth
 		}
-		if health.Status == "" {
+		if health.Status == "" && defaultHealth.Status != "" {
+			t.add(TraceSourceDefault, "status is empty, using status %s from the status map", defaultHealth.Status)
 			health.Status = defaultHealth.Status
 		}
 
 		if defaultHealth.Status != "" && isArgoHealth(health.Status) && !isArgoHealth(defaultHealth.Status) {
+			t.add(TraceSourceDefault, "replacing argo status %s with %s from the status map",
+				health.Status, defaultHealth.Status)
 			health.Status = defaultHealth.Status
 		}
-		if health.Message == "" {
+		if health.Message == "" && defaultHealth.Message != "" {
+			t.add(TraceSourceDefault, "message is empty, using the message from the status map")
 			health.Message = defaultHealth.Message
 		}
 	}
 
 	if health == nil {
+		t.add(TraceSourceDefault, "no health check matched")
 		health = &HealthStatus{
 			Status: HealthStatusUnknown,
 			Ready:  true,
 		}
 	}
 	if obj.GetDeletionTimestamp() != nil {
+		t.add(TraceSourceTerminating, "deletionTimestamp is set: status=%s, ready=false", HealthStatusTerminating)
 		health.Status = HealthStatusTerminating
 		health.Ready = false
 	}
@@ -373,96 +491,15 @@ func GetResourceHealth(
 	return health, err
 }
 
-// GetHealthCheckFunc returns built-in health check function or nil if health check is not supported
+// GetHealthCheckFunc returns the registered health check function or nil if health check is not supported
 func GetHealthCheckFunc(gvk schema.GroupVersionKind) func(obj *unstructured.Unstructured) (*HealthStatus, error) {
-	if gvk.Kind == "Node" {
-		return getNodeHealth
+	check := getHealthCheck(gvk)
+	if check == nil {
+		return nil
 	}
-
-	switch gvk.Group {
-	case "apps":
-		switch gvk.Kind {
-		case DeploymentKind:
-			return getDeploymentHealth
-		case StatefulSetKind:
-			return getStatefulSetHealth
-		case ReplicaSetKind:
-			return getReplicaSetHealth
-		case DaemonSetKind:
-			return getDaemonSetHealth
-		}
-	case "extensions":
-		switch gvk.Kind {
-		case IngressKind:
-			return getIngressHealth
-		}
-	case "argoproj.io":
-		switch gvk.Kind {
-		case "Workflow":
-			return GetArgoWorkflowHealth
-		case "Application":
-			return getArgoApplicationHealth
-		}
-	case "canaries.flanksource.com":
-		switch gvk.Kind {
-		case "Canary":
-			return getCanaryHealth
-			// case "Component":
-			// case "Topology":
-		}
-	case "configs.flanksource.com":
-		switch gvk.Kind {
-		case "ScrapeConfig":
-			return getScrapeConfigHealth
-			// 	case "ScrapePlugin":
-		}
-	case "mission-control.flanksource.com":
-		switch gvk.Kind {
-		case "Notification":
-			return getNotificationHealth
-			// 	case "Playbook":
-			// 	case "NotificationSilence":
-			// 	case "Connection":
-		}
-	case "kustomize.toolkit.fluxcd.io", "helm.toolkit.fluxcd.io", "source.toolkit.fluxcd.io":
-		return GetDefaultHealth
-	case "cert-manager.io":
-		switch gvk.Kind {
-		case "CertificateRequest":
-			return GetCertificateRequestHealth
-		default:
-			return GetCertificateHealth
-		}
-	case "networking.k8s.io":
-		switch gvk.Kind {
-		case IngressKind:
-			return getIngressHealth
-		}
-	case "":
-		switch gvk.Kind {
-		case ServiceKind:
-			return getServiceHealth
-		case PersistentVolumeClaimKind:
-			return getPVCHealth
-		case PodKind:
-			return getPodHealth
-		case NamespaceKind:
-			return getNamespaceHealth
-		}
-	case "batch":
-		switch gvk.Kind {
-		case JobKind:
-			return getJobHealth
-		case CronJobKind:
-			return getCronJobHealth
-		}
-	case "autoscaling":
-		switch gvk.Kind {
-		case HorizontalPodAutoscalerKind:
-			return getHPAHealth
-		}
+	return func(obj *unstructured.Unstructured) (*HealthStatus, error) {
+		return check.fn(obj, Options{})
 	}
-	return nil
 }
 
 func init() {
@@ -479,6 +516,14 @@ func init() {
 			azureClientSecretExpiry = v
 		}
 
+		if v := p.Int(defaultQuotaWarningThreshold, "health.resourceQuota.warningThreshold"); v != 0 {
+			quotaWarningThreshold = v
+		}
+
+		if v := p.Int(defaultQuotaCriticalThreshold, "health.resourceQuota.criticalThreshold"); v != 0 {
+			quotaCriticalThreshold = v
+		}
+
 		if v := p.Int(defaultMaxMessageLength, "health.maxMessageLength"); v != 0 {
 			maxMessageLength = v
 		}
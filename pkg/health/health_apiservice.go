@@ -1,72 +1,62 @@
 package health
 
-// apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
-// apiregistrationv1beta1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1beta1"
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
 
-// func getAPIServiceHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
-// 	gvk := obj.GroupVersionKind()
-// 	switch gvk {
-// 	case apiregistrationv1.SchemeGroupVersion.WithKind(APIServiceKind):
-// 		var apiService apiregistrationv1.APIService
-// 		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &apiService)
-// 		if err != nil {
-// 			return nil, fmt.Errorf("failed to convert unstructured APIService to typed: %v", err)
-// 		}
-// 		return getApiregistrationv1APIServiceHealth(&apiService)
-// 	case apiregistrationv1beta1.SchemeGroupVersion.WithKind(APIServiceKind):
-// 		var apiService apiregistrationv1beta1.APIService
-// 		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &apiService)
-// 		if err != nil {
-// 			return nil, fmt.Errorf("failed to convert unstructured APIService to typed: %v", err)
-// 		}
-// 		return getApiregistrationv1beta1APIServiceHealth(&apiService)
-// 	default:
-// 		return nil, fmt.Errorf("unsupported APIService GVK: %s", gvk)
-// 	}
-// }
+const (
+	// apiServiceAvailable is the condition set by the kube-aggregator once the APIService can be reached
+	apiServiceAvailable = "Available"
 
-// func getApiregistrationv1APIServiceHealth(apiservice *apiregistrationv1.APIService) (*HealthStatus, error) {
-// 	for _, c := range apiservice.Status.Conditions {
-// 		switch c.Type {
-// 		case apiregistrationv1.Available:
-// 			if c.Status == apiregistrationv1.ConditionTrue {
-// 				return &HealthStatus{
-// 					Status:  HealthStatusHealthy,
-// 					Message: fmt.Sprintf("%s: %s", c.Reason, c.Message),
-// 				}, nil
-// 			} else {
-// 				return &HealthStatus{
-// 					Status:  HealthStatusProgressing,
-// 					Message: fmt.Sprintf("%s: %s", c.Reason, c.Message),
-// 				}, nil
-// 			}
-// 		}
-// 	}
-// 	return &HealthStatus{
-// 		Status:  HealthStatusProgressing,
-// 		Message: "Waiting to be processed",
-// 	}, nil
-// }
+	// reasons of an unavailable APIService, see kube-aggregator's availability controller
+	apiServiceReasonFailedDiscoveryCheck = "FailedDiscoveryCheck"
+	apiServiceReasonMissingEndpoints     = "MissingEndpoints"
+)
 
-// func getApiregistrationv1beta1APIServiceHealth(apiservice *apiregistrationv1beta1.APIService) (*HealthStatus, error) {
-// 	for _, c := range apiservice.Status.Conditions {
-// 		switch c.Type {
-// 		case apiregistrationv1beta1.Available:
-// 			if c.Status == apiregistrationv1beta1.ConditionTrue {
-// 				return &HealthStatus{
-// 					Status:  HealthStatusHealthy,
-// 					Message: fmt.Sprintf("%s: %s", c.Reason, c.Message),
-// 				}, nil
-// 			} else {
-// 				return &HealthStatus{
-// 					Status:  HealthStatusProgressing,
-// 					Message: fmt.Sprintf("%s: %s", c.Reason, c.Message),
-// 				}, nil
-// 			}
-// 		}
-// 	}
-// 	return &HealthStatus{
-// 		Status:  HealthStatusProgressing,
-// 		Message: "Waiting to be processed",
-// 	}, nil
-// }
+// getAPIServiceHealth returns the health of an apiregistration.k8s.io v1 or v1beta1 APIService from its Available
+// condition. Local APIServices are served by the kube-apiserver itself and are always healthy.
+func getAPIServiceHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+	if service, _, _ := unstructured.NestedMap(obj.Object, "spec", "service"); service == nil {
+		return &HealthStatus{
+			Ready:   true,
+			Health:  HealthHealthy,
+			Status:  HealthStatusAvailable,
+			Message: "Local APIService",
+		}, nil
+	}
+
+	condition := GetGenericStatus(obj).FindCondition(apiServiceAvailable)
+	switch condition.Status {
+	case metav1.ConditionTrue:
+		return &HealthStatus{
+			Ready:   true,
+			Health:  HealthHealthy,
+			Status:  HealthStatusAvailable,
+			Message: condition.Message,
+		}, nil
+	case metav1.ConditionFalse:
+		status := HealthStatusCode(HumanCase(condition.Reason))
+		switch condition.Reason {
+		case apiServiceReasonFailedDiscoveryCheck:
+			// the service is reachable but does not serve the API, e.g. after a failed upgrade
+			status = HealthStatusFailedDiscoveryCheck
+		case apiServiceReasonMissingEndpoints:
+			// no pod backs the service
+			status = HealthStatusMissingEndpoints
+		case "":
+			status = HealthStatusUnavailable
+		}
+		return &HealthStatus{
+			Health:  HealthUnhealthy,
+			Status:  status,
+			Message: condition.Message,
+		}, nil
+	}
+
+	return &HealthStatus{
+		Health:  HealthUnknown,
+		Status:  HealthStatusProgressing,
+		Message: "Waiting to be processed",
+	}, nil
+}
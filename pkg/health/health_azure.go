@@ -8,13 +8,15 @@ import (
 	"github.com/flanksource/commons/duration"
 )
 
-var now = time.Now
-
 const defaultAzureClientSecretExpiry = time.Hour * 24 * 30
 
 var azureClientSecretExpiry = defaultAzureClientSecretExpiry
 
 func GetAzureHealth(configType string, obj map[string]any) HealthStatus {
+	return getAzureHealth(configType, obj, time.Now())
+}
+
+func getAzureHealth(configType string, obj map[string]any, now time.Time) HealthStatus {
 	switch configType {
 	case "Azure::AppRegistration::ClientSecret",
 		"Azure::AppRegistration::Certificate":
@@ -35,7 +37,7 @@ func GetAzureHealth(configType string, obj map[string]any) HealthStatus {
 				Message: fmt.Sprintf("%s is not a valid date time", endDateTime),
 			}
 		} else {
-			if endTime.Before(now()) {
+			if endTime.Before(now) {
 				return HealthStatus{
 					Health:  HealthUnhealthy,
 					Status:  "Expired",
@@ -43,11 +45,11 @@ func GetAzureHealth(configType string, obj map[string]any) HealthStatus {
 				}
 			}
 
-			if now().Add(azureClientSecretExpiry).After(endTime) {
+			if now.Add(azureClientSecretExpiry).After(endTime) {
 				return HealthStatus{
 					Health:  HealthWarning,
 					Status:  "Expiring",
-					Message: fmt.Sprintf("%s is expiring in %s", resourceType, duration.Duration(endTime.Sub(now()))),
+					Message: fmt.Sprintf("%s is expiring in %s", resourceType, duration.Duration(endTime.Sub(now))),
 				}
 			}
 		}
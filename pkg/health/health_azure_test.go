@@ -10,15 +10,6 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// mockNow sets the time for testing and returns a function to restore the original time.
-func mockNow(mockTime time.Time) func() {
-	originalNow := now
-	now = func() time.Time { return mockTime }
-	return func() {
-		now = originalNow
-	}
-}
-
 // Helper function to load test data from YAML files
 func loadTestData(filePath string) (map[string]any, error) {
 	absPath, err := filepath.Abs(filePath)
@@ -40,8 +31,6 @@ func loadTestData(filePath string) (map[string]any, error) {
 
 func TestGetAzureHealth_ClientSecret(t *testing.T) {
 	fixedNow := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
-	restoreOriginalNow := mockNow(fixedNow)
-	defer restoreOriginalNow()
 
 	testCases := []struct {
 		name            string
@@ -84,7 +73,7 @@ func TestGetAzureHealth_ClientSecret(t *testing.T) {
 				t.Fatalf("Failed to load test data from %s: %v", tc.fixturePath, err)
 			}
 
-			result := GetAzureHealth(tc.configType, obj)
+			result := GetHealthByConfigTypeWithOptions(tc.configType, obj, Options{Now: fixedNow})
 
 			if result.Health != tc.expectedHealth {
 				t.Errorf("Expected health %v, got %v", tc.expectedHealth, result.Health)
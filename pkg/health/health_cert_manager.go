@@ -79,6 +79,10 @@ const (
 )
 
 func GetCertificateRequestHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+	return getCertificateRequestHealth(obj, time.Now())
+}
+
+func getCertificateRequestHealth(obj *unstructured.Unstructured, now time.Time) (*HealthStatus, error) {
 	var certReq certmanagerv1.CertificateRequest
 	if err := convertFromUnstructured(obj, &certReq); err != nil {
 		return nil, fmt.Errorf("failed to convert unstructured certificateRequest to typed: %w", err)
@@ -102,7 +106,7 @@ func GetCertificateRequestHealth(obj *unstructured.Unstructured) (*HealthStatus,
 			case certmanagerv1.CertificateRequestReasonPending:
 				health := HealthUnknown
 
-				durationInPendingState := time.Since(obj.GetCreationTimestamp().Time)
+				durationInPendingState := now.Sub(obj.GetCreationTimestamp().Time)
 				if durationInPendingState > certRenewalWarningPeriod {
 					health = HealthUnhealthy
 				}
@@ -156,7 +160,7 @@ func GetCertificateRequestHealth(obj *unstructured.Unstructured) (*HealthStatus,
 			Ready:   false,
 		}
 
-		if time.Since(certReq.CreationTimestamp.Time) > time.Hour {
+		if now.Sub(certReq.CreationTimestamp.Time) > time.Hour {
 			h.Health = HealthUnhealthy
 		}
 
@@ -172,6 +176,10 @@ func GetCertificateRequestHealth(obj *unstructured.Unstructured) (*HealthStatus,
 }
 
 func GetCertificateHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+	return getCertificateHealth(obj, time.Now())
+}
+
+func getCertificateHealth(obj *unstructured.Unstructured, now time.Time) (*HealthStatus, error) {
 	var cert certmanagerv1.Certificate
 	if err := convertFromUnstructured(obj, &cert); err != nil {
 		return nil, fmt.Errorf("failed to convert unstructured certificate to typed: %w", err)
@@ -192,7 +200,7 @@ func GetCertificateHealth(obj *unstructured.Unstructured) (*HealthStatus, error)
 				hs.Health = HealthUnknown
 
 			case DoesNotExist:
-				inIssuingState := time.Since(obj.GetCreationTimestamp().Time)
+				inIssuingState := now.Sub(obj.GetCreationTimestamp().Time)
 				if inIssuingState > time.Minute*30 {
 					return &HealthStatus{
 						Status:  HealthStatusCode(c.Reason),
@@ -209,11 +217,11 @@ func GetCertificateHealth(obj *unstructured.Unstructured) (*HealthStatus, error)
 			case Renewing:
 				renewalTime := cert.Status.RenewalTime.Time
 
-				if time.Since(renewalTime) > certRenewalWarningPeriod {
+				if now.Sub(renewalTime) > certRenewalWarningPeriod {
 					hs.Health = HealthWarning
 					hs.Message = fmt.Sprintf(
 						"Certificate has been in renewal state for > %s",
-						time.Since(renewalTime).Truncate(time.Minute),
+						now.Sub(renewalTime).Truncate(time.Minute),
 					)
 				} else {
 					hs.Health = HealthHealthy
@@ -252,7 +260,7 @@ func GetCertificateHealth(obj *unstructured.Unstructured) (*HealthStatus, error)
 						Ready:   true,
 					}, nil
 				} else if cert.Status.NotBefore != nil {
-					if overdue := time.Since(cert.Status.NotBefore.Time); overdue > time.Hour {
+					if overdue := now.Sub(cert.Status.NotBefore.Time); overdue > time.Hour {
 						hs.Health = HealthUnhealthy
 						return hs, nil
 					} else if overdue > time.Minute*15 {
@@ -263,7 +271,7 @@ func GetCertificateHealth(obj *unstructured.Unstructured) (*HealthStatus, error)
 			}
 
 			// If we're issuing a new cert, at least ensure the existing cert hasn't expired
-			if expiryHealth := certExpiryCheck(cert); expiryHealth != nil {
+			if expiryHealth := certExpiryCheck(cert, now); expiryHealth != nil {
 				return expiryHealth, nil
 			} else {
 				return hs, nil
@@ -271,14 +279,14 @@ func GetCertificateHealth(obj *unstructured.Unstructured) (*HealthStatus, error)
 		}
 	}
 
-	if expiryHealth := certExpiryCheck(cert); expiryHealth != nil {
+	if expiryHealth := certExpiryCheck(cert, now); expiryHealth != nil {
 		return expiryHealth, nil
 	}
 
 	if cert.Status.RenewalTime != nil {
 		renewalTime := cert.Status.RenewalTime.Time
 
-		if time.Since(renewalTime) > certRenewalWarningPeriod {
+		if now.Sub(renewalTime) > certRenewalWarningPeriod {
 			return &HealthStatus{
 				Health:  HealthWarning,
 				Status:  HealthStatusWarning,
@@ -296,13 +304,13 @@ func GetCertificateHealth(obj *unstructured.Unstructured) (*HealthStatus, error)
 	return status, nil
 }
 
-func certExpiryCheck(cert certmanagerv1.Certificate) *HealthStatus {
+func certExpiryCheck(cert certmanagerv1.Certificate, now time.Time) *HealthStatus {
 	if cert.Status.NotAfter == nil {
 		return nil
 	}
 
 	notAfterTime := cert.Status.NotAfter.Time
-	if notAfterTime.Before(time.Now()) {
+	if notAfterTime.Before(now) {
 		return &HealthStatus{
 			Health:  HealthUnhealthy,
 			Status:  "Expired",
@@ -311,7 +319,7 @@ func certExpiryCheck(cert certmanagerv1.Certificate) *HealthStatus {
 		}
 	}
 
-	if time.Until(notAfterTime) < certExpiryWarningPeriod {
+	if notAfterTime.Sub(now) < certExpiryWarningPeriod {
 		return &HealthStatus{
 			Health:  HealthWarning,
 			Status:  HealthStatusWarning,
@@ -11,7 +11,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-func getDeploymentHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+func getDeploymentHealth(obj *unstructured.Unstructured, now time.Time) (*HealthStatus, error) {
 	gvk := obj.GroupVersionKind()
 	switch gvk {
 	case appsv1.SchemeGroupVersion.WithKind(DeploymentKind):
@@ -20,7 +20,7 @@ func getDeploymentHealth(obj *unstructured.Unstructured) (*HealthStatus, error)
 		if err != nil {
 			return nil, err
 		}
-		return getAppsv1DeploymentHealth(&deployment, obj)
+		return getAppsv1DeploymentHealth(&deployment, obj, now)
 	default:
 		return nil, fmt.Errorf("unsupported Deployment GVK: %s", gvk)
 	}
@@ -45,12 +45,12 @@ func (rs ReplicaStatus) String() string {
 	return s
 }
 
-func getReplicaHealth(s ReplicaStatus) *HealthStatus {
+func getReplicaHealth(s ReplicaStatus, now time.Time) *HealthStatus {
 	hs := &HealthStatus{
 		Message: s.String(),
 	}
 	startDeadline := GetStartDeadline(s.Containers...)
-	age := time.Since(s.Object.GetCreationTimestamp().Time).Truncate(time.Minute).Abs()
+	age := now.Sub(s.Object.GetCreationTimestamp().Time).Truncate(time.Minute).Abs()
 
 	gs := GetGenericStatus(s.Object)
 	available := gs.FindCondition("Available")
@@ -125,7 +125,11 @@ func getReplicaHealth(s ReplicaStatus) *HealthStatus {
 	return hs
 }
 
-func getAppsv1DeploymentHealth(deployment *appsv1.Deployment, obj *unstructured.Unstructured) (*HealthStatus, error) {
+func getAppsv1DeploymentHealth(
+	deployment *appsv1.Deployment,
+	obj *unstructured.Unstructured,
+	now time.Time,
+) (*HealthStatus, error) {
 	replicas := int32(0)
 	if deployment.Spec.Replicas != nil {
 		replicas = *deployment.Spec.Replicas
@@ -138,7 +142,7 @@ func getAppsv1DeploymentHealth(deployment *appsv1.Deployment, obj *unstructured.
 			Desired:    int(replicas), Replicas: int(deployment.Status.Replicas),
 			Ready: int(deployment.Status.ReadyReplicas), Updated: int(deployment.Status.UpdatedReplicas),
 			Unavailable: int(deployment.Status.UnavailableReplicas),
-		})
+		}, now)
 
 	if deployment.Spec.Paused {
 		replicaHealth.Status = HealthStatusSuspended
@@ -78,7 +78,7 @@ func parseCanaryUptime(uptime string) *float64 {
 	return &v
 }
 
-func getScrapeConfigHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+func getScrapeConfigHealth(obj *unstructured.Unstructured, now time.Time) (*HealthStatus, error) {
 	errorCount, _, err := unstructured.NestedInt64(obj.Object, "status", "lastRun", "error")
 	if err != nil {
 		return nil, err
@@ -148,12 +148,13 @@ func getScrapeConfigHealth(obj *unstructured.Unstructured) (*HealthStatus, error
 		}
 
 		// If the ScrapeConfig is few minutes behind the schedule, it's not healthy
-		if time.Since(nextRuntime) > time.Minute*10 {
+		if now.Sub(nextRuntime) > time.Minute*10 {
 			status.Status = "Stale"
 			status.Health = HealthWarning
-			status.Message = fmt.Sprintf("scraper hasn't run for %s", duration.HumanDuration(time.Since(parsedLastRuntime)))
+			status.Message = fmt.Sprintf("scraper hasn't run for %s",
+				duration.HumanDuration(now.Sub(parsedLastRuntime)))
 
-			if time.Since(nextRuntime) > time.Hour {
+			if now.Sub(nextRuntime) > time.Hour {
 				status.Health = HealthUnhealthy
 			}
 		}
@@ -162,7 +163,7 @@ func getScrapeConfigHealth(obj *unstructured.Unstructured) (*HealthStatus, error
 	return status, nil
 }
 
-func getNotificationHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+func getNotificationHealth(obj *unstructured.Unstructured, now time.Time) (*HealthStatus, error) {
 	failedCount, _, err := unstructured.NestedInt64(obj.Object, "status", "failed")
 	if err != nil {
 		return nil, err
@@ -221,7 +222,7 @@ func getNotificationHealth(obj *unstructured.Unstructured) (*HealthStatus, error
 			return nil, fmt.Errorf("failed to parse lastFailed timestamp: %w", err)
 		}
 
-		timeSinceLastFailure := time.Since(parsedLastFailedTime)
+		timeSinceLastFailure := now.Sub(parsedLastFailedTime)
 
 		if timeSinceLastFailure <= 12*time.Hour {
 			status.Health = HealthWarning
@@ -0,0 +1,214 @@
+package health
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	GatewayAPIGroup = "gateway.networking.k8s.io"
+
+	gatewayConditionAccepted     = "Accepted"
+	gatewayConditionProgrammed   = "Programmed"
+	gatewayConditionResolvedRefs = "ResolvedRefs"
+
+	// gatewayReasonPending is the reason of a condition the controller has not reconciled yet
+	gatewayReasonPending = "Pending"
+)
+
+type gatewayStatus struct {
+	Status struct {
+		Conditions []metav1.Condition `json:"conditions"`
+		Listeners  []struct {
+			Name       string             `json:"name"`
+			Conditions []metav1.Condition `json:"conditions"`
+		} `json:"listeners"`
+		Parents []struct {
+			ParentRef struct {
+				Kind        string `json:"kind"`
+				Namespace   string `json:"namespace"`
+				Name        string `json:"name"`
+				SectionName string `json:"sectionName"`
+			} `json:"parentRef"`
+			Conditions []metav1.Condition `json:"conditions"`
+		} `json:"parents"`
+	} `json:"status"`
+}
+
+// getGatewayConditionHealth returns the health of a Gateway API condition that is expected to be True, or nil if
+// it is True and observed the current generation
+func getGatewayConditionHealth(generation int64, conditions []metav1.Condition, conditionType string) *HealthStatus {
+	var condition *metav1.Condition
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			condition = &conditions[i]
+		}
+	}
+
+	switch {
+	case condition == nil:
+		return &HealthStatus{
+			Health:  HealthUnknown,
+			Status:  HealthStatusPending,
+			Message: fmt.Sprintf("Waiting for the %s condition", conditionType),
+		}
+	case condition.ObservedGeneration > 0 && condition.ObservedGeneration < generation:
+		return &HealthStatus{
+			Health:  HealthUnknown,
+			Status:  HealthStatusProgressing,
+			Message: fmt.Sprintf("Waiting for the controller to observe generation %d", generation),
+		}
+	case condition.Status == metav1.ConditionTrue:
+		return nil
+	case condition.Status == metav1.ConditionUnknown || condition.Reason == gatewayReasonPending:
+		return &HealthStatus{
+			Health:  HealthUnknown,
+			Status:  HealthStatusProgressing,
+			Message: condition.Message,
+		}
+	}
+
+	status := HealthStatusCode(HumanCase(condition.Reason))
+	if condition.Reason == "" {
+		status = HealthStatusCode("Not " + conditionType)
+	}
+	return &HealthStatus{
+		Health:  HealthUnhealthy,
+		Status:  status,
+		Message: condition.Message,
+	}
+}
+
+// getGatewayClassHealth returns the health of a GatewayClass from its Accepted condition
+func getGatewayClassHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+	var gatewayClass gatewayStatus
+	if err := convertFromUnstructured(obj, &gatewayClass); err != nil {
+		return nil, err
+	}
+
+	conditions := gatewayClass.Status.Conditions
+	if health := getGatewayConditionHealth(obj.GetGeneration(), conditions, gatewayConditionAccepted); health != nil {
+		return health, nil
+	}
+	return &HealthStatus{
+		Ready:   true,
+		Health:  HealthHealthy,
+		Status:  HealthStatusAccepted,
+		Message: GetGenericStatus(obj).FindCondition(gatewayConditionAccepted).Message,
+	}, nil
+}
+
+// getGatewayHealth returns the health of a Gateway from its Accepted and Programmed conditions, a programmed
+// Gateway with invalid listeners still serves its other listeners and is only a warning.
+func getGatewayHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+	var gateway gatewayStatus
+	if err := convertFromUnstructured(obj, &gateway); err != nil {
+		return nil, err
+	}
+
+	for _, conditionType := range []string{gatewayConditionAccepted, gatewayConditionProgrammed} {
+		health := getGatewayConditionHealth(obj.GetGeneration(), gateway.Status.Conditions, conditionType)
+		if health != nil {
+			return health, nil
+		}
+	}
+
+	health := &HealthStatus{
+		Ready:   true,
+		Health:  HealthHealthy,
+		Status:  HealthStatusProgrammed,
+		Message: GetGenericStatus(obj).FindCondition(gatewayConditionProgrammed).Message,
+	}
+	for _, listener := range gateway.Status.Listeners {
+		for _, conditionType := range []string{gatewayConditionAccepted, gatewayConditionResolvedRefs} {
+			invalid := getGatewayConditionHealth(obj.GetGeneration(), listener.Conditions, conditionType)
+			if invalid == nil || invalid.Health != HealthUnhealthy {
+				continue
+			}
+			if health.Health == HealthHealthy {
+				health.Health = HealthWarning
+				health.Status = invalid.Status
+				health.Message = ""
+			}
+			health.AppendMessage("listener %s: %s", listener.Name, invalid.Message)
+			break
+		}
+	}
+	return health, nil
+}
+
+// getGatewayRouteHealth returns the health of an HTTPRoute, GRPCRoute or other route from the Accepted and
+// ResolvedRefs conditions of each of its parents, the route is unhealthy if any parent rejects it. The ResolvedRefs
+// condition is optional.
+func getGatewayRouteHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+	var route gatewayStatus
+	if err := convertFromUnstructured(obj, &route); err != nil {
+		return nil, err
+	}
+
+	if len(route.Status.Parents) == 0 {
+		return &HealthStatus{
+			Health:  HealthUnknown,
+			Status:  HealthStatusPending,
+			Message: "Waiting for a parent to accept the route",
+		}, nil
+	}
+
+	var unhealthy, pending *HealthStatus
+	var messages []string
+	for _, parent := range route.Status.Parents {
+		ref := parent.ParentRef
+		name := strings.Join([]string{
+			lo.Ternary(ref.Kind != "", ref.Kind, "Gateway"),
+			lo.Ternary(ref.Namespace != "", ref.Namespace, obj.GetNamespace()),
+			ref.Name,
+		}, "/")
+		if ref.SectionName != "" {
+			name += ":" + ref.SectionName
+		}
+
+		for _, conditionType := range []string{gatewayConditionAccepted, gatewayConditionResolvedRefs} {
+			if conditionType == gatewayConditionResolvedRefs &&
+				!lo.ContainsBy(parent.Conditions, func(c metav1.Condition) bool { return c.Type == conditionType }) {
+				// not every implementation reports whether the references of a route are resolved
+				continue
+			}
+			health := getGatewayConditionHealth(obj.GetGeneration(), parent.Conditions, conditionType)
+			if health == nil {
+				continue
+			}
+			if health.Health == HealthUnhealthy {
+				if unhealthy == nil {
+					unhealthy = health
+				}
+				messages = append(messages, fmt.Sprintf("%s: %s", name, strings.TrimSuffix(
+					fmt.Sprintf("%s: %s", health.Status, health.Message), ": ")))
+			} else if pending == nil {
+				pending = health
+			}
+			break
+		}
+	}
+
+	switch {
+	case unhealthy != nil:
+		return &HealthStatus{
+			Health:  HealthUnhealthy,
+			Status:  unhealthy.Status,
+			Message: strings.Join(messages, ", "),
+		}, nil
+	case pending != nil:
+		return pending, nil
+	}
+	parents := len(route.Status.Parents)
+	return &HealthStatus{
+		Ready:   true,
+		Health:  HealthHealthy,
+		Status:  HealthStatusAccepted,
+		Message: fmt.Sprintf("Accepted by %d %s", parents, pluralize("parent", parents)),
+	}, nil
+}
@@ -0,0 +1,70 @@
+package health
+
+import (
+	"fmt"
+
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// getPDBHealth returns the health of a policy v1 or v1beta1 PodDisruptionBudget, a budget that allows no disruptions
+// blocks node drains and evictions and is a warning even when all its pods are healthy
+func getPDBHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+	var pdb policyv1.PodDisruptionBudget
+	if err := convertFromUnstructured(obj, &pdb); err != nil {
+		return nil, err
+	}
+
+	if pdb.Status.ObservedGeneration < pdb.Generation {
+		return &HealthStatus{
+			Health:  HealthUnknown,
+			Status:  HealthStatusProgressing,
+			Message: "Waiting for the disruption controller to observe the budget",
+		}, nil
+	}
+
+	status := pdb.Status
+	condition := meta.FindStatusCondition(status.Conditions, policyv1.DisruptionAllowedCondition)
+	if condition != nil && condition.Reason == policyv1.SyncFailedReason {
+		return &HealthStatus{
+			Ready:   true,
+			Health:  HealthUnhealthy,
+			Status:  HealthStatusCode(HumanCase(condition.Reason)),
+			Message: condition.Message,
+		}, nil
+	}
+
+	pods := fmt.Sprintf("%d/%d pods healthy, %d desired",
+		status.CurrentHealthy, status.ExpectedPods, status.DesiredHealthy)
+	switch {
+	case status.ExpectedPods == 0:
+		return &HealthStatus{
+			Ready:   true,
+			Health:  HealthUnknown,
+			Status:  HealthStatusCode("No Pods"),
+			Message: "No pods match the selector",
+		}, nil
+	case status.CurrentHealthy < status.DesiredHealthy:
+		return &HealthStatus{
+			Ready:   true,
+			Health:  HealthUnhealthy,
+			Status:  HealthStatusCode(HumanCase(policyv1.InsufficientPodsReason)),
+			Message: pods,
+		}, nil
+	case status.DisruptionsAllowed == 0:
+		return &HealthStatus{
+			Ready:   true,
+			Health:  HealthWarning,
+			Status:  HealthStatusCode("Disruptions Blocked"),
+			Message: "0 disruptions allowed, " + pods,
+		}, nil
+	}
+	return &HealthStatus{
+		Ready:  true,
+		Health: HealthHealthy,
+		Status: HealthStatusHealthy,
+		Message: fmt.Sprintf("%d %s allowed, %s",
+			status.DisruptionsAllowed, pluralize("disruption", int(status.DisruptionsAllowed)), pods),
+	}, nil
+}
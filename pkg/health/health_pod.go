@@ -10,7 +10,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-func getPodHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+func getPodHealth(obj *unstructured.Unstructured, now time.Time) (*HealthStatus, error) {
 	gvk := obj.GroupVersionKind()
 	switch gvk {
 	case corev1.SchemeGroupVersion.WithKind(PodKind):
@@ -19,15 +19,18 @@ func getPodHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
 		if err != nil {
 			return nil, err
 		}
-		return getCorev1PodHealth(&pod)
+		return getCorev1PodHealth(&pod, now)
 	default:
 		return nil, fmt.Errorf("unsupported Pod GVK: %s", gvk)
 	}
 }
 
-func getPodStatus(containers ...corev1.ContainerStatus) (waiting *HealthStatus, terminated *HealthStatus) {
+func getPodStatus(
+	now time.Time,
+	containers ...corev1.ContainerStatus,
+) (waiting *HealthStatus, terminated *HealthStatus) {
 	for _, container := range containers {
-		_waiting, _terminated := getContainerStatus(container)
+		_waiting, _terminated := getContainerStatus(container, now)
 		if _waiting != nil {
 			if waiting == nil {
 				waiting = _waiting
@@ -59,7 +62,10 @@ func pluralize(s string, i int) string {
 	return s + "s"
 }
 
-func getContainerStatus(containerStatus corev1.ContainerStatus) (waiting *HealthStatus, terminated *HealthStatus) {
+func getContainerStatus(
+	containerStatus corev1.ContainerStatus,
+	now time.Time,
+) (waiting *HealthStatus, terminated *HealthStatus) {
 	if state := containerStatus.State.Waiting; state != nil {
 		waiting = &HealthStatus{
 			Status: HealthStatusCode(state.Reason),
@@ -73,7 +79,7 @@ func getContainerStatus(containerStatus corev1.ContainerStatus) (waiting *Health
 	}
 
 	if state := containerStatus.LastTerminationState.Terminated; state != nil {
-		age := time.Since(state.FinishedAt.Time)
+		age := now.Sub(state.FinishedAt.Time)
 		// ignore old terminated statuses
 
 		if containerStatus.RestartCount == 0 && state.ExitCode == 0 {
@@ -116,11 +122,11 @@ func getContainerStatus(containerStatus corev1.ContainerStatus) (waiting *Health
 	return waiting, terminated
 }
 
-func getCorev1PodHealth(pod *corev1.Pod) (*HealthStatus, error) {
+func getCorev1PodHealth(pod *corev1.Pod, now time.Time) (*HealthStatus, error) {
 	isReady, isReadyMsg := IsPodReady(pod)
 	containers := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
 	deadline := GetStartDeadline(append(pod.Spec.InitContainers, pod.Spec.Containers...)...)
-	age := time.Since(pod.CreationTimestamp.Time).Truncate(time.Minute).Abs()
+	age := now.Sub(pod.CreationTimestamp.Time).Truncate(time.Minute).Abs()
 	isStarting := age < deadline
 	hr := HealthStatus{
 		Health:  lo.Ternary(isReady, HealthHealthy, HealthUnhealthy),
@@ -132,7 +138,7 @@ func getCorev1PodHealth(pod *corev1.Pod) (*HealthStatus, error) {
 		status := HealthUnknown
 		message := ""
 
-		terminatingFor := time.Since(pod.ObjectMeta.DeletionTimestamp.Time)
+		terminatingFor := now.Sub(pod.ObjectMeta.DeletionTimestamp.Time)
 		if terminatingFor >= time.Minute*15 {
 			status = HealthWarning
 			message = fmt.Sprintf("stuck in 'Terminating' for %s", terminatingFor.Truncate(time.Minute))
@@ -165,7 +171,7 @@ func getCorev1PodHealth(pod *corev1.Pod) (*HealthStatus, error) {
 		}
 	}
 
-	waiting, terminated := getPodStatus(containers...)
+	waiting, terminated := getPodStatus(now, containers...)
 
 	switch pod.Status.Phase {
 	case corev1.PodSucceeded:
@@ -0,0 +1,50 @@
+package health
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func getPVHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+	gvk := obj.GroupVersionKind()
+	switch gvk {
+	case corev1.SchemeGroupVersion.WithKind(PersistentVolumeKind):
+		var pv corev1.PersistentVolume
+		err := convertFromUnstructured(obj, &pv)
+		if err != nil {
+			return nil, err
+		}
+		return getCorev1PVHealth(&pv)
+	default:
+		return nil, fmt.Errorf("unsupported PersistentVolume GVK: %s", gvk)
+	}
+}
+
+func getCorev1PVHealth(pv *corev1.PersistentVolume) (*HealthStatus, error) {
+	health := HealthStatus{Status: HealthStatusCode(pv.Status.Phase), Message: pv.Status.Message}
+	switch pv.Status.Phase {
+	case corev1.VolumeAvailable, corev1.VolumeBound:
+		health.Ready = true
+		health.Health = HealthHealthy
+	case corev1.VolumePending:
+		health.Health = HealthUnknown
+	case corev1.VolumeReleased:
+		// the claim was deleted, a Retain volume has to be reclaimed manually and a Delete volume that stays
+		// Released failed to be deleted
+		health.Ready = true
+		health.Health = HealthWarning
+		if health.Message == "" && pv.Spec.ClaimRef != nil {
+			health.Message = fmt.Sprintf("claim %s/%s was deleted, reclaim policy is %s",
+				pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name, pv.Spec.PersistentVolumeReclaimPolicy)
+		}
+	case corev1.VolumeFailed:
+		health.Ready = true
+		health.Health = HealthUnhealthy
+	default:
+		health.Health = HealthUnknown
+		health.Status = HealthStatusUnknown
+	}
+	return &health, nil
+}
@@ -2,12 +2,33 @@ package health
 
 import (
 	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/duration"
 )
 
-func getPVCHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+var (
+	// PVCPendingWarningPeriod is how long a PersistentVolumeClaim can be Pending before it is a warning
+	PVCPendingWarningPeriod = 15 * time.Minute
+	// PVCPendingUnhealthyPeriod is how long a PersistentVolumeClaim can be Pending before it is unhealthy
+	PVCPendingUnhealthyPeriod = time.Hour
+)
+
+// conditions and statuses of PersistentVolumeClaims added after the k8s.io/api version in use
+const (
+	pvcControllerResizeError  = "ControllerResizeError"
+	pvcNodeResizeError        = "NodeResizeError"
+	pvcModifyingVolume        = "ModifyingVolume"
+	pvcModifyVolumeError      = "ModifyVolumeError"
+	pvcModifyVolumeInfeasible = "Infeasible"
+
+	pvcControllerResizeInfeasible corev1.ClaimResourceStatus = "ControllerResizeInfeasible"
+	pvcNodeResizeInfeasible       corev1.ClaimResourceStatus = "NodeResizeInfeasible"
+)
+
+func getPVCHealth(obj *unstructured.Unstructured, now time.Time) (*HealthStatus, error) {
 	gvk := obj.GroupVersionKind()
 	switch gvk {
 	case corev1.SchemeGroupVersion.WithKind(PersistentVolumeClaimKind):
@@ -16,23 +37,54 @@ func getPVCHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
 		if err != nil {
 			return nil, err
 		}
-		return getCorev1PVCHealth(&pvc)
+		health, err := getCorev1PVCHealth(&pvc, now)
+		if err != nil {
+			return nil, err
+		}
+
+		// status.modifyVolumeStatus is not part of the k8s.io/api version in use, a modification can be infeasible
+		// whether or not the claim is bound
+		modifyStatus, _, _ := unstructured.NestedString(obj.Object, "status", "modifyVolumeStatus", "status")
+		targetClass, _, _ := unstructured.NestedString(obj.Object,
+			"status", "modifyVolumeStatus", "targetVolumeAttributesClassName")
+		if modifyStatus == pvcModifyVolumeInfeasible && pvc.Status.Phase != corev1.ClaimLost {
+			health.Health = HealthUnhealthy
+			health.Status = HealthStatusCode("Modify Volume Infeasible")
+			health.Message = fmt.Sprintf("VolumeAttributesClass %s is infeasible", targetClass)
+		}
+		return health, nil
 	default:
 		return nil, fmt.Errorf("unsupported PersistentVolumeClaim GVK: %s", gvk)
 	}
 }
 
-func getCorev1PVCHealth(pvc *corev1.PersistentVolumeClaim) (*HealthStatus, error) {
+func getCorev1PVCHealth(pvc *corev1.PersistentVolumeClaim, now time.Time) (*HealthStatus, error) {
 	health := HealthStatus{Health: HealthHealthy}
 	switch pvc.Status.Phase {
 	case corev1.ClaimLost:
 		health.Health = HealthUnhealthy
 		health.Status = HealthStatusDegraded
+		if pvc.Spec.VolumeName != "" {
+			health.Message = fmt.Sprintf("PersistentVolume %s was lost", pvc.Spec.VolumeName)
+		}
 	case corev1.ClaimPending:
+		age := now.Sub(pvc.CreationTimestamp.Time)
 		health.Status = HealthStatusProgressing
+		switch {
+		case age >= PVCPendingUnhealthyPeriod:
+			health.Health = HealthUnhealthy
+		case age >= PVCPendingWarningPeriod:
+			health.Health = HealthWarning
+		default:
+			health.Health = HealthUnknown
+		}
+		if age >= PVCPendingWarningPeriod {
+			health.Message = fmt.Sprintf("pending for %s", duration.ShortHumanDuration(age))
+		}
 	case corev1.ClaimBound:
 		health.Ready = true
 		health.Status = HealthStatusHealthy
+		return getPVCResizeHealth(pvc, health), nil
 	default:
 		health.Health = HealthUnknown
 		health.Status = HealthStatusUnknown
@@ -40,3 +92,59 @@ func getCorev1PVCHealth(pvc *corev1.PersistentVolumeClaim) (*HealthStatus, error
 
 	return &health, nil
 }
+
+// getPVCResizeHealth returns the health of a bound PersistentVolumeClaim that is being resized or modified. Failed and
+// infeasible resizes in status.allocatedResourceStatuses are unhealthy, the resize and modify error conditions are
+// retried by the controllers and are a warning
+func getPVCResizeHealth(pvc *corev1.PersistentVolumeClaim, health HealthStatus) *HealthStatus {
+	for _, status := range pvc.Status.AllocatedResourceStatuses {
+		switch status {
+		case corev1.PersistentVolumeClaimControllerResizeFailed, corev1.PersistentVolumeClaimNodeResizeFailed,
+			pvcControllerResizeInfeasible, pvcNodeResizeInfeasible:
+			health.Health = HealthUnhealthy
+			health.Status = HealthStatusCode(HumanCase(string(status)))
+			health.Message = lastPVCConditionMessage(pvc)
+			return &health
+		}
+	}
+
+	for _, condition := range pvc.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case pvcControllerResizeError, pvcNodeResizeError, pvcModifyVolumeError:
+			health.Health = HealthWarning
+		case corev1.PersistentVolumeClaimResizing, pvcModifyingVolume:
+			health.Ready = false
+		case corev1.PersistentVolumeClaimFileSystemResizePending:
+			// the file system is only resized once a pod mounts the volume
+		default:
+			continue
+		}
+		health.Status = HealthStatusCode(HumanCase(string(condition.Type)))
+		health.Message = condition.Message
+		return &health
+	}
+
+	requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]
+	if ok && requested.Cmp(capacity) > 0 {
+		health.Ready = false
+		health.Health = HealthUnknown
+		health.Status = HealthStatusCode("Resize Pending")
+		health.Message = fmt.Sprintf("requested %s, capacity %s", requested.String(), capacity.String())
+	}
+	return &health
+}
+
+func lastPVCConditionMessage(pvc *corev1.PersistentVolumeClaim) string {
+	var message string
+	var last time.Time
+	for _, condition := range pvc.Status.Conditions {
+		if condition.Message != "" && !condition.LastTransitionTime.Time.Before(last) {
+			message, last = condition.Message, condition.LastTransitionTime.Time
+		}
+	}
+	return message
+}
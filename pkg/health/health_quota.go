@@ -0,0 +1,120 @@
+package health
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	defaultQuotaWarningThreshold  = 80
+	defaultQuotaCriticalThreshold = 95
+)
+
+var (
+	// quotaWarningThreshold and quotaCriticalThreshold are the percentages of a ResourceQuota's hard limit in use
+	// at which it is a warning and unhealthy
+	quotaWarningThreshold  = defaultQuotaWarningThreshold
+	quotaCriticalThreshold = defaultQuotaCriticalThreshold
+)
+
+type quotaUsage struct {
+	name        corev1.ResourceName
+	used, hard  string
+	utilisation float64
+}
+
+func (u quotaUsage) String() string {
+	return fmt.Sprintf("%s %s/%s (%.0f%%)", u.name, u.used, u.hard, u.utilisation)
+}
+
+// getResourceQuotaHealth returns the health of a ResourceQuota from the utilisation of its most used resource,
+// requests that exceed a hard limit are rejected so an exhausted quota is unhealthy
+func getResourceQuotaHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+	var quota corev1.ResourceQuota
+	if err := convertFromUnstructured(obj, &quota); err != nil {
+		return nil, err
+	}
+
+	if len(quota.Status.Hard) == 0 {
+		return &HealthStatus{
+			Health:  HealthUnknown,
+			Status:  HealthStatusPending,
+			Message: "Waiting for the quota controller to calculate the usage",
+		}, nil
+	}
+
+	var usages []quotaUsage
+	for name, hard := range quota.Status.Hard {
+		used := quota.Status.Used[name]
+		if hard.IsZero() {
+			// a zero limit forbids the resource altogether
+			continue
+		}
+		usages = append(usages, quotaUsage{
+			name:        name,
+			used:        used.String(),
+			hard:        hard.String(),
+			utilisation: used.AsApproximateFloat64() / hard.AsApproximateFloat64() * 100,
+		})
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].utilisation != usages[j].utilisation {
+			return usages[i].utilisation > usages[j].utilisation
+		}
+		return usages[i].name < usages[j].name
+	})
+
+	health := &HealthStatus{Ready: true, Health: HealthHealthy, Status: HealthStatusHealthy}
+	if len(usages) == 0 {
+		return health, nil
+	}
+
+	var exceeded []string
+	for _, usage := range usages {
+		if usage.utilisation >= float64(min(quotaWarningThreshold, quotaCriticalThreshold)) {
+			exceeded = append(exceeded, usage.String())
+		}
+	}
+	switch highest := usages[0].utilisation; {
+	case highest >= 100:
+		health.Health = HealthUnhealthy
+		health.Status = HealthStatusCode("Quota Exhausted")
+	case highest >= float64(quotaCriticalThreshold):
+		health.Health = HealthUnhealthy
+		health.Status = HealthStatusCode("Quota Nearly Exhausted")
+	case highest >= float64(quotaWarningThreshold):
+		health.Health = HealthWarning
+		health.Status = HealthStatusCode("Quota Nearly Exhausted")
+	default:
+		exceeded = []string{usages[0].String()}
+	}
+	health.Message = strings.Join(exceeded, ", ")
+	return health, nil
+}
+
+// getLimitRangeHealth returns a LimitRange as healthy, it has no status and its limits are validated on admission
+func getLimitRangeHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+	var limitRange corev1.LimitRange
+	if err := convertFromUnstructured(obj, &limitRange); err != nil {
+		return nil, err
+	}
+
+	message := "no limits"
+	if len(limitRange.Spec.Limits) > 0 {
+		var types []string
+		for _, limit := range limitRange.Spec.Limits {
+			types = append(types, string(limit.Type))
+		}
+		message = fmt.Sprintf("limits for %s", strings.Join(types, ", "))
+	}
+	return &HealthStatus{
+		Ready:   true,
+		Health:  HealthHealthy,
+		Status:  HealthStatusHealthy,
+		Message: message,
+	}, nil
+}
@@ -2,13 +2,14 @@ package health
 
 import (
 	"fmt"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-func getReplicaSetHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+func getReplicaSetHealth(obj *unstructured.Unstructured, now time.Time) (*HealthStatus, error) {
 	gvk := obj.GroupVersionKind()
 	switch gvk {
 	case appsv1.SchemeGroupVersion.WithKind(ReplicaSetKind):
@@ -17,13 +18,17 @@ func getReplicaSetHealth(obj *unstructured.Unstructured) (*HealthStatus, error)
 		if err != nil {
 			return nil, err
 		}
-		return getAppsv1ReplicaSetHealth(&replicaSet, obj)
+		return getAppsv1ReplicaSetHealth(&replicaSet, obj, now)
 	default:
 		return nil, fmt.Errorf("unsupported ReplicaSet GVK: %s", gvk)
 	}
 }
 
-func getAppsv1ReplicaSetHealth(rs *appsv1.ReplicaSet, obj *unstructured.Unstructured) (*HealthStatus, error) {
+func getAppsv1ReplicaSetHealth(
+	rs *appsv1.ReplicaSet,
+	obj *unstructured.Unstructured,
+	now time.Time,
+) (*HealthStatus, error) {
 	replicas := int32(0)
 	if rs.Spec.Replicas != nil {
 		replicas = *rs.Spec.Replicas
@@ -36,7 +41,7 @@ func getAppsv1ReplicaSetHealth(rs *appsv1.ReplicaSet, obj *unstructured.Unstruct
 		Replicas:   int(rs.Status.Replicas),
 		Ready:      int(rs.Status.ReadyReplicas),
 		Updated:    int(rs.Status.FullyLabeledReplicas),
-	})
+	}, now)
 
 	if rs.Generation != rs.Status.ObservedGeneration {
 		hr.Status = HealthStatusUpdating
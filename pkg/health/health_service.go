@@ -6,10 +6,48 @@ import (
 
 	"github.com/samber/lo"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-func getServiceHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+// ServiceEndpointsGracePeriod is how long a Service with a selector can go without ready endpoints after its
+// creation before it is unhealthy
+var ServiceEndpointsGracePeriod = 10 * time.Minute
+
+// EndpointLookup returns the EndpointSlices and/or Endpoints of a Service, or none if they are not known
+type EndpointLookup interface {
+	GetEndpoints(namespace, service string) ([]*unstructured.Unstructured, error)
+}
+
+// EndpointIndex is an EndpointLookup over a set of objects, e.g. the output of
+// `kubectl get services,endpointslices -o yaml`
+type EndpointIndex map[string][]*unstructured.Unstructured
+
+// NewEndpointIndex indexes the Endpoints and EndpointSlices of the objects by their Service, other objects are
+// ignored
+func NewEndpointIndex(objs ...*unstructured.Unstructured) EndpointIndex {
+	index := EndpointIndex{}
+	for _, obj := range objs {
+		var service string
+		switch obj.GroupVersionKind() {
+		case corev1.SchemeGroupVersion.WithKind(EndpointsKind):
+			service = obj.GetName()
+		case discoveryv1.SchemeGroupVersion.WithKind(EndpointSliceKind):
+			service = obj.GetLabels()[discoveryv1.LabelServiceName]
+		}
+		if service != "" {
+			key := obj.GetNamespace() + "/" + service
+			index[key] = append(index[key], obj)
+		}
+	}
+	return index
+}
+
+func (i EndpointIndex) GetEndpoints(namespace, service string) ([]*unstructured.Unstructured, error) {
+	return i[namespace+"/"+service], nil
+}
+
+func getServiceHealth(obj *unstructured.Unstructured, opts Options) (*HealthStatus, error) {
 	gvk := obj.GroupVersionKind()
 	switch gvk {
 	case corev1.SchemeGroupVersion.WithKind(ServiceKind):
@@ -18,13 +56,27 @@ func getServiceHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
 		if err != nil {
 			return nil, err
 		}
-		return getCorev1ServiceHealth(&service)
+		if service.Spec.Type == corev1.ServiceTypeExternalName {
+			// ExternalName Services have no endpoints
+			return getExternalNameServiceHealth(&service), nil
+		}
+		if opts.Endpoints == nil {
+			return getCorev1ServiceHealth(&service, opts.now())
+		}
+		endpoints, err := opts.Endpoints.GetEndpoints(service.Namespace, service.Name)
+		if err != nil {
+			// the health without the endpoints is still better than none
+			health, _ := getCorev1ServiceHealth(&service, opts.now())
+			health.AppendMessage("failed to get the endpoints: %v", err)
+			return health, nil
+		}
+		return getCorev1ServiceHealthWithEndpoints(&service, endpoints, opts.now())
 	default:
 		return nil, fmt.Errorf("unsupported Service GVK: %s", gvk)
 	}
 }
 
-func getCorev1ServiceHealth(service *corev1.Service) (*HealthStatus, error) {
+func getCorev1ServiceHealth(service *corev1.Service, now time.Time) (*HealthStatus, error) {
 	health := HealthStatus{Health: HealthHealthy, Status: HealthStatusHealthy}
 	if service.Spec.Type == corev1.ServiceTypeLoadBalancer {
 		if len(service.Status.LoadBalancer.Ingress) > 0 {
@@ -32,7 +84,7 @@ func getCorev1ServiceHealth(service *corev1.Service) (*HealthStatus, error) {
 			health.Health = HealthHealthy
 			health.Ready = true
 		} else {
-			age := time.Since(service.CreationTimestamp.Time)
+			age := now.Sub(service.CreationTimestamp.Time)
 			health.Status = HealthStatusCreating
 			health.Health = lo.Ternary(age < time.Hour, HealthUnknown, HealthUnhealthy)
 		}
@@ -43,3 +95,120 @@ func getCorev1ServiceHealth(service *corev1.Service) (*HealthStatus, error) {
 	}
 	return &health, nil
 }
+
+func getExternalNameServiceHealth(service *corev1.Service) *HealthStatus {
+	if service.Spec.ExternalName == "" {
+		return &HealthStatus{
+			Ready:   true,
+			Health:  HealthUnhealthy,
+			Status:  HealthStatusError,
+			Message: "ExternalName service without an externalName",
+		}
+	}
+	return &HealthStatus{
+		Ready:   true,
+		Health:  HealthHealthy,
+		Status:  HealthStatusRunning,
+		Message: "external name " + service.Spec.ExternalName,
+	}
+}
+
+// getCorev1ServiceHealthWithEndpoints returns the health of the Service from its ready and not ready endpoints. A
+// Service with a selector and no ready endpoints is unhealthy after the ServiceEndpointsGracePeriod, Services without
+// a selector have endpoints that are managed manually.
+func getCorev1ServiceHealthWithEndpoints(
+	service *corev1.Service,
+	endpoints []*unstructured.Unstructured,
+	now time.Time,
+) (*HealthStatus, error) {
+	health, err := getCorev1ServiceHealth(service, now)
+	if err != nil || len(endpoints) == 0 {
+		// nothing is known about the endpoints
+		return health, err
+	}
+
+	ready, notReady, err := countEndpoints(endpoints)
+	if err != nil {
+		return nil, err
+	}
+	if service.Spec.PublishNotReadyAddresses {
+		// e.g. the headless services of StatefulSets, the peers are discoverable before they are ready
+		ready, notReady = ready+notReady, 0
+	}
+	message := fmt.Sprintf("%d/%d endpoints ready", ready, ready+notReady)
+	if service.Spec.ClusterIP == corev1.ClusterIPNone {
+		message = "headless, " + message
+	}
+
+	switch {
+	case ready > 0:
+		if service.Spec.Type != corev1.ServiceTypeLoadBalancer || health.Ready {
+			health.Health = HealthHealthy
+			health.Status = HealthStatusRunning
+			health.Ready = true
+		}
+	case len(service.Spec.Selector) == 0:
+		// the endpoints are managed manually, e.g. for a database outside of the cluster
+		health.Health = HealthUnknown
+		health.Status = HealthStatusUnknown
+		health.Ready = true
+	default:
+		health.Ready = false
+		health.Status = lo.Ternary(notReady > 0, HealthStatusNoReadyEndpoints, HealthStatusNoEndpoints)
+		health.Health = lo.Ternary(now.Sub(service.CreationTimestamp.Time) < ServiceEndpointsGracePeriod,
+			HealthUnknown, HealthUnhealthy)
+	}
+	health.AppendMessage("%s", message)
+	return health, nil
+}
+
+// countEndpoints returns the number of ready and not ready addresses of the EndpointSlices, or of the Endpoints
+// when there are no EndpointSlices
+func countEndpoints(objs []*unstructured.Unstructured) (ready, notReady int, err error) {
+	var slices, endpoints []*unstructured.Unstructured
+	for _, obj := range objs {
+		if obj.GetKind() == EndpointSliceKind {
+			slices = append(slices, obj)
+		} else {
+			endpoints = append(endpoints, obj)
+		}
+	}
+
+	if len(slices) > 0 {
+		// an endpoint is listed by the slices of every address type of a dual-stack service, and can briefly be
+		// listed by several slices of the same type, it is ready if any of them says so
+		readyEndpoints := map[string]bool{}
+		for _, obj := range slices {
+			var slice discoveryv1.EndpointSlice
+			if err := convertFromUnstructured(obj, &slice); err != nil {
+				return 0, 0, err
+			}
+			for _, endpoint := range slice.Endpoints {
+				if len(endpoint.Addresses) == 0 {
+					continue
+				}
+				key := endpoint.Addresses[0]
+				if ref := endpoint.TargetRef; ref != nil && ref.Name != "" {
+					key = ref.Kind + "/" + ref.Namespace + "/" + ref.Name
+				}
+				// a nil ready condition is an unknown state that consumers interpret as ready
+				readyEndpoints[key] = readyEndpoints[key] || endpoint.Conditions.Ready == nil ||
+					*endpoint.Conditions.Ready
+			}
+		}
+		ready = lo.CountBy(lo.Values(readyEndpoints), func(ready bool) bool { return ready })
+		return ready, len(readyEndpoints) - ready, nil
+	}
+
+	for _, obj := range endpoints {
+		var e corev1.Endpoints
+		if err := convertFromUnstructured(obj, &e); err != nil {
+			return 0, 0, err
+		}
+		for _, subset := range e.Subsets {
+			ready += len(subset.Addresses)
+			notReady += len(subset.NotReadyAddresses)
+		}
+	}
+	return ready, notReady, nil
+}
@@ -2,12 +2,13 @@ package health
 
 import (
 	"fmt"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-func getStatefulSetHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+func getStatefulSetHealth(obj *unstructured.Unstructured, now time.Time) (*HealthStatus, error) {
 	gvk := obj.GroupVersionKind()
 	switch gvk {
 	case appsv1.SchemeGroupVersion.WithKind(StatefulSetKind):
@@ -15,13 +16,17 @@ func getStatefulSetHealth(obj *unstructured.Unstructured) (*HealthStatus, error)
 		if err := convertFromUnstructured(obj, &sts); err != nil {
 			return nil, err
 		}
-		return getAppsv1StatefulSetHealth(&sts, obj)
+		return getAppsv1StatefulSetHealth(&sts, obj, now)
 	default:
 		return nil, fmt.Errorf("unsupported StatefulSet GVK: %s", gvk)
 	}
 }
 
-func getAppsv1StatefulSetHealth(sts *appsv1.StatefulSet, obj *unstructured.Unstructured) (*HealthStatus, error) {
+func getAppsv1StatefulSetHealth(
+	sts *appsv1.StatefulSet,
+	obj *unstructured.Unstructured,
+	now time.Time,
+) (*HealthStatus, error) {
 	replicas := int32(0)
 	if sts.Spec.Replicas != nil {
 		replicas = *sts.Spec.Replicas
@@ -33,7 +38,7 @@ func getAppsv1StatefulSetHealth(sts *appsv1.StatefulSet, obj *unstructured.Unstr
 			Containers: sts.Spec.Template.Spec.Containers,
 			Desired:    int(replicas), Replicas: int(sts.Status.Replicas),
 			Ready: int(sts.Status.ReadyReplicas), Updated: int(sts.Status.UpdatedReplicas),
-		})
+		}, now)
 
 	replicaHealth.Ready = sts.Status.Replicas == sts.Status.UpdatedReplicas
 
@@ -0,0 +1,76 @@
+package health
+
+import (
+	"fmt"
+	"strings"
+
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// getStorageClassHealth returns a StorageClass as healthy, it has no status and only describes how volumes are
+// provisioned
+func getStorageClassHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+	var storageClass storagev1.StorageClass
+	if err := convertFromUnstructured(obj, &storageClass); err != nil {
+		return nil, err
+	}
+
+	details := []string{storageClass.Provisioner}
+	if storageClass.Annotations["storageclass.kubernetes.io/is-default-class"] == "true" {
+		details = append([]string{"default"}, details...)
+	}
+	if storageClass.VolumeBindingMode != nil {
+		details = append(details, string(*storageClass.VolumeBindingMode))
+	}
+	if storageClass.AllowVolumeExpansion != nil && *storageClass.AllowVolumeExpansion {
+		details = append(details, "expandable")
+	}
+	return &HealthStatus{
+		Ready:   true,
+		Health:  HealthHealthy,
+		Status:  HealthStatusAvailable,
+		Message: strings.Join(details, ", "),
+	}, nil
+}
+
+// getVolumeAttachmentHealth returns the health of a VolumeAttachment from its attach and detach errors, the errors
+// are retried by the attacher so a VolumeAttachment with an error is not ready
+func getVolumeAttachmentHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+	var attachment storagev1.VolumeAttachment
+	if err := convertFromUnstructured(obj, &attachment); err != nil {
+		return nil, err
+	}
+
+	volume := attachment.Name
+	if attachment.Spec.Source.PersistentVolumeName != nil {
+		volume = *attachment.Spec.Source.PersistentVolumeName
+	}
+
+	switch {
+	case attachment.DeletionTimestamp != nil && attachment.Status.DetachError != nil:
+		return &HealthStatus{
+			Health:  HealthUnhealthy,
+			Status:  HealthStatusDetachError,
+			Message: attachment.Status.DetachError.Message,
+		}, nil
+	case attachment.Status.AttachError != nil:
+		return &HealthStatus{
+			Health:  HealthUnhealthy,
+			Status:  HealthStatusAttachError,
+			Message: attachment.Status.AttachError.Message,
+		}, nil
+	case attachment.Status.Attached:
+		return &HealthStatus{
+			Ready:   true,
+			Health:  HealthHealthy,
+			Status:  HealthStatusAttached,
+			Message: fmt.Sprintf("%s attached to %s", volume, attachment.Spec.NodeName),
+		}, nil
+	}
+	return &HealthStatus{
+		Health:  HealthUnknown,
+		Status:  HealthStatusAttaching,
+		Message: fmt.Sprintf("attaching %s to %s", volume, attachment.Spec.NodeName),
+	}, nil
+}
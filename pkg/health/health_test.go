@@ -13,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/flanksource/commons/properties"
 	"github.com/flanksource/is-healthy/pkg/health"
 	_ "github.com/flanksource/is-healthy/pkg/lua"
 	"github.com/samber/lo"
@@ -286,6 +287,22 @@ func TestCertificateRequest(t *testing.T) {
 	)
 }
 
+func TestResourceHealthAtTime(t *testing.T) {
+	yamlBytes, err := os.ReadFile("./testdata/certificate-request-pending.yaml")
+	require.NoError(t, err)
+	var obj unstructured.Unstructured
+	require.NoError(t, yaml.Unmarshal(yamlBytes, &obj))
+	created := obj.GetCreationTimestamp().Time
+
+	hr, err := health.GetResourceHealthWithOptions(&obj, health.Options{Now: created.Add(10 * time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, health.HealthUnknown, hr.Health)
+
+	hr, err = health.GetResourceHealthWithOptions(&obj, health.Options{Now: created.Add(2 * time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, health.HealthUnhealthy, hr.Health)
+}
+
 //nolint:unused
 func testCertificate(t *testing.T) {
 	// assertAppHealthWithOverwriteMsg(t, "./testdata/certificate-issuing-stuck.yaml", map[string]string{
@@ -403,7 +420,53 @@ func TestDaemonSetOnDeleteHealth(t *testing.T) {
 
 func TestPVCHealth(t *testing.T) {
 	assertAppHealthMsg(t, "./testdata/pvc-bound.yaml", health.HealthStatusHealthy, health.HealthHealthy, true)
-	assertAppHealthMsg(t, "./testdata/pvc-pending.yaml", health.HealthStatusProgressing, health.HealthHealthy, false)
+
+	data, err := os.ReadFile("./testdata/pvc-pending.yaml")
+	require.NoError(t, err)
+	pvc := parseObjects(t, string(data))[0]
+	created := pvc.GetCreationTimestamp().Time
+	for _, test := range []struct {
+		age     time.Duration
+		health  health.Health
+		message string
+	}{
+		{5 * time.Minute, health.HealthUnknown, ""},
+		{30 * time.Minute, health.HealthWarning, "pending for 30m"},
+		{48 * time.Hour, health.HealthUnhealthy, "pending for 2d"},
+	} {
+		hr, err := health.GetResourceHealthWithOptions(pvc, health.Options{Now: created.Add(test.age)})
+		require.NoError(t, err, test.age)
+		assert.Equal(t, health.HealthStatusProgressing, hr.Status, test.age)
+		assert.Equal(t, test.health, hr.Health, test.age)
+		assert.False(t, hr.Ready, test.age)
+		assert.Equal(t, test.message, hr.Message, test.age)
+	}
+
+	// a volume modification can fail before the claim is bound
+	require.NoError(t, unstructured.SetNestedStringMap(pvc.Object, map[string]string{
+		"status":                          "Infeasible",
+		"targetVolumeAttributesClassName": "gp3-invalid",
+	}, "status", "modifyVolumeStatus"))
+	hr, err := health.GetResourceHealthWithOptions(pvc, health.Options{Now: created.Add(5 * time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, health.HealthUnhealthy, hr.Health)
+	assert.Equal(t, health.HealthStatusCode("Modify Volume Infeasible"), hr.Status)
+	assert.False(t, hr.Ready)
+	assert.Equal(t, "VolumeAttributesClass gp3-invalid is infeasible", hr.Message)
+}
+
+func TestResourceQuotaThresholds(t *testing.T) {
+	file := "./testdata/Kubernetes/ResourceQuota/warning.yaml"
+	assertAppHealthMsg(t, file, "Quota Nearly Exhausted", health.HealthWarning, true)
+
+	properties.Set("health.resourceQuota.warningThreshold", 90)
+	t.Cleanup(func() { properties.Set("health.resourceQuota.warningThreshold", 80) })
+	assertAppHealthMsg(t, file, health.HealthStatusHealthy, health.HealthHealthy, true,
+		"limits.memory 7Gi/8Gi (88%)")
+
+	properties.Set("health.resourceQuota.criticalThreshold", 85)
+	t.Cleanup(func() { properties.Set("health.resourceQuota.criticalThreshold", 95) })
+	assertAppHealthMsg(t, file, "Quota Nearly Exhausted", health.HealthUnhealthy, true)
 }
 
 func TestIngressHealth(t *testing.T) {
@@ -483,12 +546,38 @@ func TestHPA(t *testing.T) {
 	)
 }
 
-// func TestAPIService(t *testing.T) {
-// 	assertAppHealthMsg(t, "./testdata/apiservice-v1-true.yaml", HealthStatusHealthy, health.HealthHealthy, true)
-// 	assertAppHealthMsg(t, "./testdata/apiservice-v1-false.yaml", HealthStatusProgressing, health.HealthHealthy, true)
-// 	assertAppHealthMsg(t, "./testdata/apiservice-v1beta1-true.yaml", HealthStatusHealthy, health.HealthHealthy, true)
-// 	assertAppHealthMsg(t, "./testdata/apiservice-v1beta1-false.yaml", HealthStatusProgressing, health.HealthHealthy, true)
-// }
+func TestAPIService(t *testing.T) {
+	assertAppHealthMsg(
+		t,
+		"./testdata/apiservice-v1-true.yaml",
+		health.HealthStatusAvailable,
+		health.HealthHealthy,
+		true,
+		"all checks passed",
+	)
+	assertAppHealthMsg(
+		t,
+		"./testdata/apiservice-v1-false.yaml",
+		health.HealthStatusMissingEndpoints,
+		health.HealthUnhealthy,
+		false,
+		`endpoints for service/cert-manager-webhook in "external-dns" have no addresses`,
+	)
+	assertAppHealthMsg(
+		t,
+		"./testdata/apiservice-v1beta1-true.yaml",
+		health.HealthStatusAvailable,
+		health.HealthHealthy,
+		true,
+	)
+	assertAppHealthMsg(
+		t,
+		"./testdata/apiservice-v1beta1-false.yaml",
+		health.HealthStatusMissingEndpoints,
+		health.HealthUnhealthy,
+		false,
+	)
+}
 
 func TestGetArgoWorkflowHealth(t *testing.T) {
 	sampleWorkflow := unstructured.Unstructured{
@@ -623,3 +712,187 @@ func TestFluxResources(t *testing.T) {
 		false,
 	)
 }
+
+func TestResourceHealthTrace(t *testing.T) {
+	yamlBytes, err := os.ReadFile("./testdata/flux-helmrelease-upgradefailed.yaml")
+	require.NoError(t, err)
+	var obj unstructured.Unstructured
+	require.NoError(t, yaml.Unmarshal(yamlBytes, &obj))
+
+	withoutTrace, err := health.GetResourceHealth(&obj, health.DefaultOverrides)
+	require.NoError(t, err)
+	assert.Empty(t, withoutTrace.Trace)
+
+	hr, err := health.GetResourceHealthWithOptions(&obj, health.Options{Override: health.DefaultOverrides, Trace: true})
+	require.NoError(t, err)
+	assert.Equal(t, withoutTrace.Status, hr.Status)
+	require.NotEmpty(t, hr.Trace)
+
+	sources := lo.Map(hr.Trace, func(s health.TraceStep, _ int) string { return s.Source })
+	assert.Contains(t, sources, health.TraceSourceStatusMap)
+	assert.Contains(t, sources, health.TraceSourceCondition)
+	assert.Equal(t, health.TraceSourceGo, hr.Trace[len(hr.Trace)-1].Source)
+	assert.Contains(t, hr.Trace[0].Message, "HelmRelease")
+}
+
+func TestServiceEndpoints(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	service := func(name, spec string) string {
+		return `
+apiVersion: v1
+kind: Service
+metadata:
+  name: ` + name + `
+  namespace: default
+  creationTimestamp: "2025-01-01T11:55:00Z"
+spec:
+` + spec
+	}
+	slice := func(service, ready string) string {
+		return `
+apiVersion: discovery.k8s.io/v1
+kind: EndpointSlice
+metadata:
+  name: ` + service + `-abcde
+  namespace: default
+  labels:
+    kubernetes.io/service-name: ` + service + `
+addressType: IPv4
+endpoints:
+- addresses: [10.0.0.1]
+  conditions:
+    ready: ` + ready + `
+- addresses: [10.0.0.2]
+  conditions: {}
+`
+	}
+	// the slices of a dual-stack service list the pods with their address of each type
+	dualStackSlice := func(addressType, address, notReadyAddress string) string {
+		return `
+apiVersion: discovery.k8s.io/v1
+kind: EndpointSlice
+metadata:
+  name: dual-stack-` + strings.ToLower(addressType) + `
+  namespace: default
+  labels:
+    kubernetes.io/service-name: dual-stack
+addressType: ` + addressType + `
+endpoints:
+- addresses: ["` + address + `"]
+  conditions: {ready: true}
+  targetRef: {kind: Pod, namespace: default, name: dual-stack-1}
+- addresses: ["` + notReadyAddress + `"]
+  conditions: {ready: false}
+  targetRef: {kind: Pod, namespace: default, name: dual-stack-2}
+`
+	}
+	endpoints := `
+apiVersion: v1
+kind: Endpoints
+metadata:
+  name: legacy
+  namespace: default
+subsets:
+- notReadyAddresses:
+  - ip: 10.0.0.3
+`
+	objs := parseObjects(t,
+		service("ready", "  selector: {app: ready}"), slice("ready", "false"),
+		service("not-ready", "  selector: {app: not-ready}"), slice("not-ready", "false"),
+		service("legacy", "  selector: {app: legacy}"), endpoints,
+		service("external", "  type: ExternalName\n  externalName: db.example.com"),
+		service("headless", "  clusterIP: None\n  publishNotReadyAddresses: true\n  selector: {app: headless}"),
+		slice("headless", "false"),
+		service("unknown", "  selector: {app: unknown}"),
+		service("no-endpoints", "  selector: {app: none}"),
+		`
+apiVersion: discovery.k8s.io/v1
+kind: EndpointSlice
+metadata:
+  name: no-endpoints-abcde
+  namespace: default
+  labels:
+    kubernetes.io/service-name: no-endpoints
+addressType: IPv4
+endpoints: []
+`,
+		service("dual-stack", "  selector: {app: dual-stack}"),
+		dualStackSlice("IPv4", "10.0.0.1", "10.0.0.2"),
+		dualStackSlice("IPv6", "fd00::1", "fd00::2"),
+	)
+	// the endpoint without a ready condition counts as ready
+	unstructured.RemoveNestedField(objs[3].Object, "endpoints")
+	require.NoError(t, unstructured.SetNestedSlice(objs[3].Object, []any{
+		map[string]any{"addresses": []any{"10.0.0.1"}, "conditions": map[string]any{"ready": false}},
+	}, "endpoints"))
+
+	opts := health.Options{Now: now, Endpoints: health.NewEndpointIndex(objs...)}
+	get := func(t *testing.T, i int, opts health.Options) *health.HealthStatus {
+		hr, err := health.GetResourceHealthWithOptions(objs[i], opts)
+		require.NoError(t, err)
+		return hr
+	}
+
+	t.Run("ready", func(t *testing.T) {
+		hr := get(t, 0, opts)
+		assert.Equal(t, health.HealthHealthy, hr.Health)
+		assert.Equal(t, health.HealthStatusRunning, hr.Status)
+		assert.True(t, hr.Ready)
+		assert.Equal(t, "1/2 endpoints ready", hr.Message)
+	})
+
+	t.Run("not ready within the grace period", func(t *testing.T) {
+		hr := get(t, 2, opts)
+		assert.Equal(t, health.HealthUnknown, hr.Health)
+		assert.Equal(t, health.HealthStatusNoReadyEndpoints, hr.Status)
+		assert.False(t, hr.Ready)
+		assert.Equal(t, "0/1 endpoints ready", hr.Message)
+	})
+
+	t.Run("not ready after the grace period", func(t *testing.T) {
+		later := opts
+		later.Now = now.Add(time.Hour)
+		hr := get(t, 2, later)
+		assert.Equal(t, health.HealthUnhealthy, hr.Health)
+		assert.Equal(t, health.HealthStatusNoReadyEndpoints, hr.Status)
+
+		hr = get(t, 4, later)
+		assert.Equal(t, health.HealthUnhealthy, hr.Health)
+		assert.Equal(t, "0/1 endpoints ready", hr.Message)
+
+		// the endpoint slice controller creates an empty slice for a selector that does not match any pod
+		hr = get(t, 10, later)
+		assert.Equal(t, health.HealthUnhealthy, hr.Health)
+		assert.Equal(t, health.HealthStatusNoEndpoints, hr.Status)
+	})
+
+	t.Run("external name", func(t *testing.T) {
+		hr := get(t, 6, opts)
+		assert.Equal(t, health.HealthHealthy, hr.Health)
+		assert.Equal(t, "external name db.example.com", hr.Message)
+
+		// ExternalName services do not need the endpoints
+		hr = get(t, 6, health.Options{Now: now})
+		assert.Equal(t, health.HealthHealthy, hr.Health)
+		assert.Equal(t, "external name db.example.com", hr.Message)
+	})
+
+	t.Run("headless publishing not ready addresses", func(t *testing.T) {
+		hr := get(t, 7, opts)
+		assert.Equal(t, health.HealthHealthy, hr.Health)
+		assert.Equal(t, "headless, 2/2 endpoints ready", hr.Message)
+	})
+
+	t.Run("dual stack", func(t *testing.T) {
+		hr := get(t, 12, opts)
+		assert.Equal(t, health.HealthHealthy, hr.Health)
+		assert.Equal(t, "1/2 endpoints ready", hr.Message)
+	})
+
+	t.Run("without endpoints", func(t *testing.T) {
+		// nothing is known about the endpoints of the service
+		hr := get(t, 9, opts)
+		assert.Equal(t, health.HealthUnknown, hr.Health)
+		assert.True(t, hr.Ready)
+	})
+}
@@ -0,0 +1,231 @@
+package health
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TreeNode is the health of an object together with the objects it owns
+type TreeNode struct {
+	Object *unstructured.Unstructured `json:"-"`
+
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+
+	// Health is the health of the object evaluated in isolation
+	Health HealthStatus `json:"health"`
+	// Rollup is the health of the object merged with the propagated health of all its descendants
+	Rollup HealthStatus `json:"rollup"`
+
+	Children []*TreeNode `json:"children,omitempty"`
+}
+
+func (n TreeNode) Key() string {
+	if n.Namespace == "" {
+		return fmt.Sprintf("%s/%s", n.Kind, n.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", n.Kind, n.Namespace, n.Name)
+}
+
+// RollupRule controls how the health of a child is propagated to its parent
+type RollupRule struct {
+	// ParentKind and ChildKind restrict the rule to specific kinds, empty or "*" matches any kind
+	ParentKind string `json:"parentKind,omitempty" yaml:"parentKind,omitempty"`
+	ChildKind  string `json:"childKind,omitempty"  yaml:"childKind,omitempty"`
+
+	// Propagate maps the rolled-up health of the child to the health that is merged into the parent,
+	// child health values that are not in the map are not propagated.
+	Propagate map[Health]Health `json:"propagate" yaml:"propagate"`
+}
+
+func (r RollupRule) matches(parent, child string) bool {
+	return (r.ParentKind == "" || r.ParentKind == "*" || r.ParentKind == parent) &&
+		(r.ChildKind == "" || r.ChildKind == "*" || r.ChildKind == child)
+}
+
+// DefaultRollupRules propagate unhealthy and warning children as-is, except for the job history kept by a
+// CronJob where a failed run is only a warning for the CronJob.
+var DefaultRollupRules = []RollupRule{
+	{
+		ParentKind: CronJobKind,
+		ChildKind:  JobKind,
+		Propagate: map[Health]Health{
+			HealthUnhealthy: HealthWarning,
+			HealthWarning:   HealthWarning,
+		},
+	},
+	{
+		Propagate: map[Health]Health{
+			HealthUnhealthy: HealthUnhealthy,
+			HealthWarning:   HealthWarning,
+		},
+	},
+}
+
+type TreeOptions struct {
+	// Rules are evaluated in order, the first matching rule is used. Defaults to DefaultRollupRules
+	Rules []RollupRule
+	// Override is used for the health of each object, defaults to DefaultOverrides
+	Override HealthOverride
+}
+
+// GetTreeHealth builds the ownership graph of the objects using ownerReferences (Deployment→ReplicaSet→Pod,
+// CronJob→Job→Pod etc.) and the managed resources of Argo Applications, and returns the root nodes with
+// both their own and their rolled-up health.
+func GetTreeHealth(objs []*unstructured.Unstructured, opts ...TreeOptions) ([]*TreeNode, error) {
+	opt := TreeOptions{Rules: DefaultRollupRules, Override: DefaultOverrides}
+	if len(opts) > 0 {
+		if opts[0].Rules != nil {
+			opt.Rules = opts[0].Rules
+		}
+		if opts[0].Override != nil {
+			opt.Override = opts[0].Override
+		}
+	}
+
+	nodes := make([]*TreeNode, 0, len(objs))
+	byUID := make(map[string]*TreeNode)
+	byKey := make(map[string]*TreeNode)
+	endpoints := NewEndpointIndex(objs...)
+	for _, obj := range objs {
+		hr, err := GetResourceHealthWithOptions(obj, Options{Override: opt.Override, Endpoints: endpoints})
+		if hr == nil {
+			return nil, fmt.Errorf("%s/%s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		node := &TreeNode{
+			Object:    obj,
+			Kind:      obj.GetKind(),
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+			Health:    *hr,
+		}
+		nodes = append(nodes, node)
+		if uid := string(obj.GetUID()); uid != "" {
+			byUID[uid] = node
+		}
+		byKey[treeKey(obj.GroupVersionKind().Group, node.Kind, node.Namespace, node.Name)] = node
+	}
+
+	// an object can have several owners, e.g. an owned resource that is also tracked by an Argo Application
+	hasParent := make(map[*TreeNode]bool)
+	link := func(parent, child *TreeNode) {
+		if parent == nil || child == nil || parent == child || slices.Contains(parent.Children, child) {
+			return
+		}
+		parent.Children = append(parent.Children, child)
+		hasParent[child] = true
+	}
+
+	for _, node := range nodes {
+		for _, ref := range node.Object.GetOwnerReferences() {
+			owner := byUID[string(ref.UID)]
+			if owner == nil {
+				group := strings.Split(ref.APIVersion, "/")[0]
+				if !strings.Contains(ref.APIVersion, "/") {
+					group = ""
+				}
+				owner = byKey[treeKey(group, ref.Kind, node.Namespace, ref.Name)]
+			}
+			link(owner, node)
+		}
+	}
+
+	for _, node := range nodes {
+		if node.Kind != "Application" || node.Object.GroupVersionKind().Group != "argoproj.io" {
+			continue
+		}
+		resources, _, _ := unstructured.NestedSlice(node.Object.Object, "status", "resources")
+		for _, r := range resources {
+			resource, ok := r.(map[string]any)
+			if !ok {
+				continue
+			}
+			child := byKey[treeKey(
+				get(resource, "group"),
+				get(resource, "kind"),
+				get(resource, "namespace"),
+				get(resource, "name"),
+			)]
+			link(node, child)
+		}
+	}
+
+	var roots []*TreeNode
+	for _, node := range nodes {
+		if !hasParent[node] {
+			roots = append(roots, node)
+		}
+	}
+
+	visited := make(map[*TreeNode]visitState)
+	for _, root := range roots {
+		rollup(root, opt.Rules, visited)
+	}
+	// every node of an ownerReference cycle has a parent, the first node of each cycle becomes a root instead
+	for _, node := range nodes {
+		if visited[node] == unvisited {
+			roots = append(roots, node)
+			rollup(node, opt.Rules, visited)
+		}
+	}
+	return roots, nil
+}
+
+type visitState int
+
+const (
+	unvisited visitState = iota
+	visiting
+	visited
+)
+
+func treeKey(group, kind, namespace, name string) string {
+	return strings.Join([]string{group, kind, namespace, name}, "/")
+}
+
+// rollup merges the propagated health of the descendants into the rollup of each node, nodes with several parents
+// are only rolled up once and the edges that close an ownerReference cycle are removed.
+func rollup(node *TreeNode, rules []RollupRule, state map[*TreeNode]visitState) HealthStatus {
+	if state[node] == visited {
+		return node.Rollup
+	}
+	state[node] = visiting
+	node.Rollup = node.Health
+
+	children := node.Children[:0]
+	for _, child := range node.Children {
+		if state[child] == visiting {
+			// the child is also an ancestor of the node
+			continue
+		}
+		children = append(children, child)
+		childHealth := rollup(child, rules, state)
+		propagated, ok := propagate(rules, node.Kind, child.Kind, childHealth.Health)
+		if !ok {
+			continue
+		}
+		node.Rollup = node.Rollup.Merge(&HealthStatus{
+			Ready:   childHealth.Ready,
+			Health:  propagated,
+			Status:  childHealth.Status,
+			Message: fmt.Sprintf("%s: %s", child.Key(), childHealth.String()),
+		})
+	}
+	node.Children = children
+	state[node] = visited
+	return node.Rollup
+}
+
+func propagate(rules []RollupRule, parent, child string, h Health) (Health, bool) {
+	for _, rule := range rules {
+		if rule.matches(parent, child) {
+			propagated, ok := rule.Propagate[h]
+			return propagated, ok && propagated != ""
+		}
+	}
+	return "", false
+}
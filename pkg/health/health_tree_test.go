@@ -0,0 +1,239 @@
+package health_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+func parseObjects(t *testing.T, docs ...string) []*unstructured.Unstructured {
+	var objs []*unstructured.Unstructured
+	for _, doc := range docs {
+		obj := &unstructured.Unstructured{}
+		require.NoError(t, yaml.Unmarshal([]byte(doc), &obj.Object))
+		objs = append(objs, obj)
+	}
+	return objs
+}
+
+const (
+	treeDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+  namespace: default
+  uid: d1
+spec:
+  replicas: 1
+status:
+  replicas: 1
+  readyReplicas: 1
+  updatedReplicas: 1
+  availableReplicas: 1
+  conditions:
+  - type: Progressing
+    status: "True"
+    reason: NewReplicaSetAvailable
+  - type: Available
+    status: "True"
+`
+	treeReplicaSet = `
+apiVersion: apps/v1
+kind: ReplicaSet
+metadata:
+  name: nginx-5d4f
+  namespace: default
+  uid: r1
+  ownerReferences:
+  - apiVersion: apps/v1
+    kind: Deployment
+    name: nginx
+    uid: d1
+spec:
+  replicas: 1
+status:
+  replicas: 1
+  readyReplicas: 1
+  availableReplicas: 1
+`
+	treeFailedPod = `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: nginx-5d4f-abcde
+  namespace: default
+  ownerReferences:
+  - apiVersion: apps/v1
+    kind: ReplicaSet
+    name: nginx-5d4f
+status:
+  phase: Failed
+  message: OOMKilled
+`
+	treeCronJob = `
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+  namespace: default
+  uid: c1
+spec:
+  schedule: "* * * * *"
+`
+	treeFailedJob = `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: backup-1234
+  namespace: default
+  ownerReferences:
+  - apiVersion: batch/v1
+    kind: CronJob
+    name: backup
+    uid: c1
+status:
+  conditions:
+  - type: Failed
+    status: "True"
+    reason: BackoffLimitExceeded
+`
+	treeApplication = `
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: nginx
+  namespace: argocd
+status:
+  health:
+    status: Healthy
+  sync:
+    status: Synced
+  resources:
+  - group: apps
+    kind: Deployment
+    name: nginx
+    namespace: default
+`
+)
+
+func TestGetTreeHealth(t *testing.T) {
+	roots, err := health.GetTreeHealth(parseObjects(t, treeDeployment, treeReplicaSet, treeFailedPod))
+	require.NoError(t, err)
+	require.Len(t, roots, 1)
+
+	deployment := roots[0]
+	assert.Equal(t, "Deployment", deployment.Kind)
+	assert.Equal(t, health.HealthHealthy, deployment.Health.Health)
+	require.Len(t, deployment.Children, 1)
+	require.Len(t, deployment.Children[0].Children, 1)
+
+	pod := deployment.Children[0].Children[0]
+	assert.Equal(t, health.HealthUnhealthy, pod.Health.Health)
+	assert.Equal(t, health.HealthUnhealthy, deployment.Children[0].Rollup.Health)
+	assert.Equal(t, health.HealthUnhealthy, deployment.Rollup.Health)
+	assert.Contains(t, deployment.Rollup.Message, "Pod/default/nginx-5d4f-abcde")
+}
+
+func TestGetTreeHealthCronJob(t *testing.T) {
+	roots, err := health.GetTreeHealth(parseObjects(t, treeCronJob, treeFailedJob))
+	require.NoError(t, err)
+	require.Len(t, roots, 1)
+	assert.Equal(t, health.HealthUnhealthy, roots[0].Children[0].Health.Health)
+	assert.Equal(t, health.HealthWarning, roots[0].Rollup.Health)
+}
+
+func TestGetTreeHealthArgoApplication(t *testing.T) {
+	roots, err := health.GetTreeHealth(
+		parseObjects(t, treeApplication, treeDeployment, treeReplicaSet, treeFailedPod),
+	)
+	require.NoError(t, err)
+	require.Len(t, roots, 1)
+	assert.Equal(t, "Application", roots[0].Kind)
+	assert.Equal(t, health.HealthHealthy, roots[0].Health.Health)
+	assert.Equal(t, health.HealthUnhealthy, roots[0].Rollup.Health)
+}
+
+func TestGetTreeHealthRules(t *testing.T) {
+	roots, err := health.GetTreeHealth(
+		parseObjects(t, treeDeployment, treeReplicaSet, treeFailedPod),
+		health.TreeOptions{Rules: []health.RollupRule{
+			{ChildKind: "Pod", Propagate: map[health.Health]health.Health{}},
+			{Propagate: map[health.Health]health.Health{health.HealthUnhealthy: health.HealthUnhealthy}},
+		}},
+	)
+	require.NoError(t, err)
+	require.Len(t, roots, 1)
+	assert.Equal(t, health.HealthHealthy, roots[0].Rollup.Health)
+}
+
+func TestGetTreeHealthOwnerCycle(t *testing.T) {
+	roots, err := health.GetTreeHealth(parseObjects(t, `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  namespace: default
+  uid: a
+  ownerReferences:
+  - apiVersion: v1
+    kind: ConfigMap
+    name: b
+    uid: b
+`, `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: b
+  namespace: default
+  uid: b
+  ownerReferences:
+  - apiVersion: v1
+    kind: ConfigMap
+    name: a
+    uid: a
+status:
+  phase: Failed
+`))
+	require.NoError(t, err)
+	require.Len(t, roots, 1, "the cycle is not dropped")
+	assert.Equal(t, "a", roots[0].Name)
+	require.Len(t, roots[0].Children, 1)
+	assert.Equal(t, "b", roots[0].Children[0].Name)
+	assert.Empty(t, roots[0].Children[0].Children, "the edge closing the cycle is removed")
+	assert.Equal(t, health.HealthUnhealthy, roots[0].Rollup.Health)
+
+	_, err = json.Marshal(roots)
+	assert.NoError(t, err)
+}
+
+func TestGetTreeHealthSharedChild(t *testing.T) {
+	// the ReplicaSet is owned by the Deployment and also tracked by the Application
+	application := strings.Replace(treeApplication, `    namespace: default
+`, `    namespace: default
+  - group: apps
+    kind: ReplicaSet
+    name: nginx-5d4f
+    namespace: default
+`, 1)
+	roots, err := health.GetTreeHealth(
+		parseObjects(t, application, treeDeployment, treeReplicaSet, treeFailedPod),
+	)
+	require.NoError(t, err)
+	require.Len(t, roots, 1)
+	require.Len(t, roots[0].Children, 2)
+
+	deployment, replicaSet := roots[0].Children[0], roots[0].Children[1]
+	assert.Equal(t, "ReplicaSet", replicaSet.Kind)
+	assert.Same(t, replicaSet, deployment.Children[0])
+	// the second visit keeps the rollup of the ReplicaSet's own children
+	assert.Equal(t, health.HealthUnhealthy, replicaSet.Rollup.Health)
+	assert.Equal(t, health.HealthUnhealthy, deployment.Rollup.Health)
+	assert.Equal(t, health.HealthUnhealthy, roots[0].Rollup.Health)
+}
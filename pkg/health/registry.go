@@ -0,0 +1,241 @@
+package health
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// HealthCheckFunc returns the health of an object, or nil if it cannot determine it
+type HealthCheckFunc func(obj *unstructured.Unstructured) (*HealthStatus, error)
+
+// HealthCheckAtFunc is a HealthCheckFunc that evaluates the health as of now, see Options.Now
+type HealthCheckAtFunc func(obj *unstructured.Unstructured, now time.Time) (*HealthStatus, error)
+
+// GVKMatcher selects the objects a registered health check applies to. Each field accepts `*` wildcards,
+// e.g. `*.fluxcd.io`. The Group is matched as is so an empty group only matches the core API group,
+// an empty Version or Kind matches any value.
+type GVKMatcher struct {
+	Group   string
+	Version string
+	Kind    string
+
+	// Priority orders the matching health checks, the highest priority wins. Built-in checks use a priority
+	// of 0, ties are broken by the most specific matcher and then by the most recent registration.
+	Priority int
+}
+
+func (m GVKMatcher) Matches(gvk schema.GroupVersionKind) bool {
+	return matchField(m.Group, gvk.Group, false) &&
+		matchField(m.Version, gvk.Version, true) &&
+		matchField(m.Kind, gvk.Kind, true)
+}
+
+func (m GVKMatcher) String() string {
+	group := m.Group
+	if group == "" {
+		group = "core"
+	}
+	kind := m.Kind
+	if kind == "" {
+		kind = "*"
+	}
+	if m.Version == "" || m.Version == "*" {
+		return group + "/" + kind
+	}
+	return fmt.Sprintf("%s/%s/%s", group, m.Version, kind)
+}
+
+// specificity ranks exact fields over patterns over wildcards that match anything
+func (m GVKMatcher) specificity() int {
+	return fieldSpecificity(m.Group, false) + fieldSpecificity(m.Version, true) + fieldSpecificity(m.Kind, true)
+}
+
+func fieldSpecificity(pattern string, emptyMatchesAll bool) int {
+	switch {
+	case pattern == "*" || (pattern == "" && emptyMatchesAll):
+		return 0
+	case strings.Contains(pattern, "*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+func matchField(pattern, value string, emptyMatchesAll bool) bool {
+	if pattern == "*" || (pattern == "" && emptyMatchesAll) {
+		return true
+	}
+	if !strings.Contains(pattern, "*") {
+		return pattern == value
+	}
+	matched, _ := path.Match(pattern, value)
+	return matched
+}
+
+// healthCheck is a registered health check evaluated with the Options of the evaluation
+type healthCheck struct {
+	name string
+	fn   func(obj *unstructured.Unstructured, opts Options) (*HealthStatus, error)
+	// traced is used instead of fn when tracing, to record the decisions taken by the check itself
+	traced func(obj *unstructured.Unstructured, t *tracer) (*HealthStatus, error)
+}
+
+// check wraps a health check that does not depend on the current time
+func check(fn HealthCheckFunc) *healthCheck {
+	return &healthCheck{
+		name: funcName(fn),
+		fn: func(obj *unstructured.Unstructured, _ Options) (*HealthStatus, error) {
+			return fn(obj)
+		},
+	}
+}
+
+func checkAt(fn HealthCheckAtFunc) *healthCheck {
+	return &healthCheck{
+		name: funcName(fn),
+		fn: func(obj *unstructured.Unstructured, opts Options) (*HealthStatus, error) {
+			return fn(obj, opts.now())
+		},
+	}
+}
+
+// checkWithOptions wraps a built-in health check that relies on other Options than Now, e.g. Endpoints
+func checkWithOptions(fn func(obj *unstructured.Unstructured, opts Options) (*HealthStatus, error)) *healthCheck {
+	return &healthCheck{name: funcName(fn), fn: fn}
+}
+
+// tracedCheck wraps a health check that records its decisions in the trace of the evaluation
+func tracedCheck(fn func(obj *unstructured.Unstructured, t *tracer) (*HealthStatus, error)) *healthCheck {
+	return &healthCheck{
+		name: funcName(fn),
+		fn: func(obj *unstructured.Unstructured, _ Options) (*HealthStatus, error) {
+			return fn(obj, nil)
+		},
+		traced: fn,
+	}
+}
+
+type registration struct {
+	matcher GVKMatcher
+	check   *healthCheck
+}
+
+var (
+	registryLock sync.RWMutex
+	registry     []registration
+)
+
+// Register adds a health check for the objects selected by the matcher and returns a function that removes it.
+// The check with the highest priority wins, at the same priority the most specific matcher wins, so a check
+// registered with the default priority of 0 replaces the built-in check of a kind only when its matcher is at least
+// as specific, e.g. apps/Deployment but not */Deployment. Between equally specific matchers the last registered wins.
+func Register(matcher GVKMatcher, fn HealthCheckFunc) (unregister func()) {
+	return register(matcher, check(fn))
+}
+
+// RegisterAt adds a health check that honors Options.Now, see Register
+func RegisterAt(matcher GVKMatcher, fn HealthCheckAtFunc) (unregister func()) {
+	return register(matcher, checkAt(fn))
+}
+
+func register(matcher GVKMatcher, check *healthCheck) func() {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry = append(registry, registration{matcher: matcher, check: check})
+	return func() {
+		registryLock.Lock()
+		defer registryLock.Unlock()
+		registry = slices.DeleteFunc(registry, func(r registration) bool { return r.check == check })
+	}
+}
+
+func getHealthCheck(gvk schema.GroupVersionKind) *healthCheck {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	var best *registration
+	for i := range registry {
+		r := &registry[i]
+		if !r.matcher.Matches(gvk) {
+			continue
+		}
+		if best == nil || r.matcher.Priority > best.matcher.Priority ||
+			(r.matcher.Priority == best.matcher.Priority &&
+				r.matcher.specificity() >= best.matcher.specificity()) {
+			best = r
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.check
+}
+
+// listRegisteredTypes returns the group/kind (or group/version/kind) of every registered health check
+func listRegisteredTypes() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	seen := make(map[string]bool)
+	var types []string
+	for _, r := range registry {
+		if t := r.matcher.String(); !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+func init() {
+	for _, builtin := range []struct {
+		GVKMatcher
+		*healthCheck
+	}{
+		{GVKMatcher{Group: "*", Kind: "Node"}, check(getNodeHealth)},
+		{GVKMatcher{Group: "apps", Kind: DeploymentKind}, checkAt(getDeploymentHealth)},
+		{GVKMatcher{Group: "apps", Kind: StatefulSetKind}, checkAt(getStatefulSetHealth)},
+		{GVKMatcher{Group: "apps", Kind: ReplicaSetKind}, checkAt(getReplicaSetHealth)},
+		{GVKMatcher{Group: "apps", Kind: DaemonSetKind}, check(getDaemonSetHealth)},
+		{GVKMatcher{Group: "extensions", Kind: IngressKind}, check(getIngressHealth)},
+		{GVKMatcher{Group: "networking.k8s.io", Kind: IngressKind}, check(getIngressHealth)},
+		{GVKMatcher{Group: "argoproj.io", Kind: "Workflow"}, check(GetArgoWorkflowHealth)},
+		{GVKMatcher{Group: "argoproj.io", Kind: "Application"}, check(getArgoApplicationHealth)},
+		{GVKMatcher{Group: "canaries.flanksource.com", Kind: "Canary"}, check(getCanaryHealth)},
+		{GVKMatcher{Group: "configs.flanksource.com", Kind: "ScrapeConfig"}, checkAt(getScrapeConfigHealth)},
+		{GVKMatcher{Group: "mission-control.flanksource.com", Kind: "Notification"}, checkAt(getNotificationHealth)},
+		{GVKMatcher{Group: "kustomize.toolkit.fluxcd.io"}, tracedCheck(getDefaultHealth)},
+		{GVKMatcher{Group: "helm.toolkit.fluxcd.io"}, tracedCheck(getDefaultHealth)},
+		{GVKMatcher{Group: "source.toolkit.fluxcd.io"}, tracedCheck(getDefaultHealth)},
+		{GVKMatcher{Group: "cert-manager.io"}, checkAt(getCertificateHealth)},
+		{GVKMatcher{Group: "cert-manager.io", Kind: "CertificateRequest"}, checkAt(getCertificateRequestHealth)},
+		{GVKMatcher{Kind: ServiceKind}, checkWithOptions(getServiceHealth)},
+		{GVKMatcher{Kind: PersistentVolumeClaimKind}, checkAt(getPVCHealth)},
+		{GVKMatcher{Kind: PersistentVolumeKind}, check(getPVHealth)},
+		{GVKMatcher{Group: "storage.k8s.io", Kind: StorageClassKind}, check(getStorageClassHealth)},
+		{GVKMatcher{Group: "storage.k8s.io", Kind: VolumeAttachmentKind}, check(getVolumeAttachmentHealth)},
+		{GVKMatcher{Kind: PodKind}, checkAt(getPodHealth)},
+		{GVKMatcher{Kind: NamespaceKind}, check(getNamespaceHealth)},
+		{GVKMatcher{Group: "batch", Kind: JobKind}, check(getJobHealth)},
+		{GVKMatcher{Group: "batch", Kind: CronJobKind}, check(getCronJobHealth)},
+		{GVKMatcher{Group: "autoscaling", Kind: HorizontalPodAutoscalerKind}, check(getHPAHealth)},
+		{GVKMatcher{Group: "apiregistration.k8s.io", Kind: APIServiceKind}, check(getAPIServiceHealth)},
+		{GVKMatcher{Group: "policy", Kind: PodDisruptionBudgetKind}, check(getPDBHealth)},
+		{GVKMatcher{Kind: ResourceQuotaKind}, check(getResourceQuotaHealth)},
+		{GVKMatcher{Kind: LimitRangeKind}, check(getLimitRangeHealth)},
+		{GVKMatcher{Group: GatewayAPIGroup, Kind: "GatewayClass"}, check(getGatewayClassHealth)},
+		{GVKMatcher{Group: GatewayAPIGroup, Kind: "Gateway"}, check(getGatewayHealth)},
+		{GVKMatcher{Group: GatewayAPIGroup, Kind: "*Route"}, check(getGatewayRouteHealth)},
+	} {
+		register(builtin.GVKMatcher, builtin.healthCheck)
+	}
+}
@@ -0,0 +1,95 @@
+package health_test
+
+import (
+	"testing"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func staticHealth(status health.HealthStatusCode) health.HealthCheckFunc {
+	return func(obj *unstructured.Unstructured) (*health.HealthStatus, error) {
+		return &health.HealthStatus{Health: health.HealthHealthy, Status: status, Ready: true}, nil
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Cleanup(health.Register(
+		health.GVKMatcher{Group: "*.registry.example.com", Kind: "Widget"},
+		staticHealth("Wildcard"),
+	))
+	t.Cleanup(health.Register(
+		health.GVKMatcher{Group: "a.registry.example.com", Kind: "Widget"},
+		staticHealth("Specific"),
+	))
+	t.Cleanup(health.Register(
+		health.GVKMatcher{Group: "*.registry.example.com", Kind: "Gadget", Priority: 10},
+		staticHealth("Priority"),
+	))
+	t.Cleanup(health.Register(
+		health.GVKMatcher{Group: "a.registry.example.com", Kind: "Gadget"},
+		staticHealth("Specific"),
+	))
+	t.Cleanup(health.Register(
+		health.GVKMatcher{Group: "a.registry.example.com", Version: "v2", Kind: "*"},
+		staticHealth("Version"),
+	))
+	// less specific than the built-in apps/Deployment check
+	t.Cleanup(health.Register(health.GVKMatcher{Group: "*", Kind: "Deployment"}, staticHealth("Wildcard")))
+
+	tests := []struct {
+		gvk    schema.GroupVersionKind
+		status health.HealthStatusCode
+	}{
+		{schema.GroupVersionKind{Group: "b.registry.example.com", Version: "v1", Kind: "Widget"}, "Wildcard"},
+		{schema.GroupVersionKind{Group: "a.registry.example.com", Version: "v1", Kind: "Widget"}, "Specific"},
+		{schema.GroupVersionKind{Group: "a.registry.example.com", Version: "v1", Kind: "Gadget"}, "Priority"},
+		{schema.GroupVersionKind{Group: "a.registry.example.com", Version: "v2", Kind: "Gizmo"}, "Version"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.gvk.String(), func(t *testing.T) {
+			obj := &unstructured.Unstructured{Object: map[string]any{}}
+			obj.SetGroupVersionKind(tc.gvk)
+			obj.SetName("test")
+
+			hr, err := health.GetResourceHealth(obj, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.status, hr.Status)
+		})
+	}
+
+	deployment := &unstructured.Unstructured{Object: map[string]any{}}
+	deployment.SetGroupVersionKind(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+	hr, err := health.GetResourceHealth(deployment, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, health.HealthStatusCode("Wildcard"), hr.Status, "the built-in check is more specific")
+
+	assert.Nil(t, health.GetHealthCheckFunc(schema.GroupVersionKind{Group: "registry.example.com", Kind: "Widget"}))
+	assert.Contains(t, health.ListResourceTypes(), "*.registry.example.com/Widget")
+	assert.Contains(t, health.ListResourceTypes(), "a.registry.example.com/v2/*")
+	assert.Contains(t, health.ListResourceTypes(), "apps/Deployment")
+}
+
+func TestUnregister(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	builtin := health.GetHealthCheckFunc(gvk)
+	unregister := health.Register(health.GVKMatcher{Group: "apps", Kind: "Deployment"}, staticHealth("Override"))
+
+	obj := &unstructured.Unstructured{Object: map[string]any{}}
+	obj.SetGroupVersionKind(gvk)
+	hr, err := health.GetHealthCheckFunc(gvk)(obj)
+	require.NoError(t, err)
+	assert.Equal(t, health.HealthStatusCode("Override"), hr.Status)
+
+	unregister()
+	hr, err = health.GetHealthCheckFunc(gvk)(obj)
+	require.NoError(t, err)
+	expected, err := builtin(obj)
+	require.NoError(t, err)
+	assert.Equal(t, expected, hr)
+	assert.NotContains(t, health.ListResourceTypes(), "*/Deployment")
+}
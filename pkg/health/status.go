@@ -1,11 +1,16 @@
 package health
 
 import (
+	"bytes"
 	_ "embed"
+	"errors"
+	"fmt"
+	"io"
 	"strings"
+	"sync"
 
 	"github.com/samber/lo"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -14,7 +19,10 @@ import (
 //go:embed statusMap.yaml
 var statusYaml []byte
 
-var statusByKind map[string]StatusMap
+var (
+	statusByKindLock sync.RWMutex
+	statusByKind     map[string]StatusMap
+)
 
 func init() {
 	statusByKind = make(map[string]StatusMap)
@@ -23,6 +31,79 @@ func init() {
 	}
 }
 
+// LoadStatusMaps parses each YAML document in order and merges its status maps over the ones already loaded.
+// Keys are a Kind, a group/Kind or an apiVersion/Kind, and may reference the anchors of the built-in
+// statusMap.yaml (e.g. `MyRelease: *flux`) or of an earlier document.
+func LoadStatusMaps(docs ...[]byte) error {
+	// the documents are decoded from a single stream, the anchors of a YAML stream are visible to the documents
+	// that follow them
+	stream := bytes.Join(append([][]byte{statusYaml}, docs...), []byte("\n---\n"))
+	decoder := yaml.NewDecoder(bytes.NewReader(stream))
+
+	var layers []map[string]StatusMap
+	for {
+		var layer map[string]StatusMap
+		if err := decoder.Decode(&layer); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to parse status map: %w", err)
+		}
+		layers = append(layers, layer)
+	}
+
+	// the first layer are the built-in status maps
+	for _, layer := range layers[1:] {
+		MergeStatusMaps(layer)
+	}
+	return nil
+}
+
+// MergeStatusMaps merges status maps over the ones already loaded. Conditions replace the existing mapping
+// of the same condition type, filters are evaluated before the existing filters.
+func MergeStatusMaps(maps map[string]StatusMap) {
+	statusByKindLock.Lock()
+	defer statusByKindLock.Unlock()
+
+	for key, statusMap := range maps {
+		existing, ok := statusByKind[key]
+		if !ok {
+			statusByKind[key] = statusMap
+			continue
+		}
+
+		merged := StatusMap{
+			Filters:             append(append([]Filter{}, statusMap.Filters...), existing.Filters...),
+			Conditions:          make(map[string]Condition),
+			UnhealthyIsNotReady: existing.UnhealthyIsNotReady || statusMap.UnhealthyIsNotReady,
+		}
+		for k, v := range existing.Conditions {
+			merged.Conditions[k] = v
+		}
+		for k, v := range statusMap.Conditions {
+			merged.Conditions[k] = v
+		}
+		statusByKind[key] = merged
+	}
+}
+
+func getStatusMap(keys ...string) (StatusMap, string, bool) {
+	statusByKindLock.RLock()
+	defer statusByKindLock.RUnlock()
+	for _, key := range keys {
+		if statusMap, ok := statusByKind[key]; ok {
+			return statusMap, key, true
+		}
+	}
+	return StatusMap{}, "", false
+}
+
+// GetStatusMap returns the loaded status map of the first key found, keys are a Kind, a group/Kind or an
+// apiVersion/Kind
+func GetStatusMap(keys ...string) (StatusMap, bool) {
+	statusMap, _, ok := getStatusMap(keys...)
+	return statusMap, ok
+}
+
 type status struct {
 	Status struct {
 		Conditions []metav1.Condition
@@ -143,14 +224,26 @@ type Condition struct {
 
 	// Custom settings per reason
 	Reasons map[string]OnCondition `yaml:"reasons,omitempty" json:"reasons,omitempty"`
+
+	// Expr restricts the mapping to objects and conditions for which it evaluates to true, see EvalExpression
+	Expr string `yaml:"expr,omitempty" json:"expr,omitempty"`
 }
 
 func (mapped *Condition) Apply(health *HealthStatus, c *metav1.Condition) {
+	mapped.apply(health, c, nil)
+}
+
+func (mapped *Condition) apply(health *HealthStatus, c *metav1.Condition, t *tracer) {
+	before := *health
+	branch := "no mapping"
 	if c.Status == metav1.ConditionTrue {
+		branch = fmt.Sprintf("onTrue, order %d", mapped.Order)
 		mapped.OnCondition.Apply(health, c)
 	} else if c.Status == metav1.ConditionFalse && mapped.OnFalse != nil {
+		branch = fmt.Sprintf("onFalse, order %d", mapped.OnFalse.Order)
 		mapped.OnFalse.Apply(health, c)
 	} else if c.Status == metav1.ConditionFalse && mapped.OnFalse == nil {
+		branch = fmt.Sprintf("implicit onFalse, order %d", mapped.Order)
 		if mapped.Health == HealthHealthy {
 			// if this is a healthy condition and no specific onFalse handling, mark unhealthy
 			health.Health = HealthUnhealthy
@@ -172,15 +265,21 @@ func (mapped *Condition) Apply(health *HealthStatus, c *metav1.Condition) {
 			}
 		}
 	} else if c.Status == metav1.ConditionUnknown && mapped.OnUnknown != nil {
+		branch = fmt.Sprintf("onUnknown, order %d", mapped.OnUnknown.Order)
 		mapped.OnUnknown.Apply(health, c)
 	}
+	t.changed(TraceSourceCondition, fmt.Sprintf("%s=%s reason=%s (%s)", c.Type, c.Status, c.Reason, branch),
+		before, *health)
 
 	if reason, ok := mapped.Reasons[c.Reason]; ok {
 		reason.Order = max(reason.Order, lo.FromPtr(mapped).Order)
 		if c.Status == metav1.ConditionFalse {
 			reason.Order = max(reason.Order, lo.FromPtr(mapped.OnFalse).Order)
 		}
+		before = *health
 		reason.Apply(health, c)
+		t.changed(TraceSourceCondition,
+			fmt.Sprintf("%s=%s reasons[%s] (order %d)", c.Type, c.Status, c.Reason, reason.Order), before, *health)
 	}
 }
 
@@ -188,6 +287,8 @@ type Filter struct {
 	OnCondition `yaml:",inline" json:",inline,omitempty"`
 
 	Match map[string]string `yaml:"match,omitempty" json:"match,omitempty"`
+	// Expr must also evaluate to true for the filter to match, see EvalExpression
+	Expr string `yaml:"expr,omitempty"  json:"expr,omitempty"`
 }
 type StatusMap struct {
 	Filters             []Filter             `yaml:"filters"             json:"filters"`
@@ -198,6 +299,10 @@ type StatusMap struct {
 const NoCondition = "none"
 
 func GetDefaultHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
+	return getDefaultHealth(obj, nil)
+}
+
+func getDefaultHealth(obj *unstructured.Unstructured, t *tracer) (*HealthStatus, error) {
 	kind := obj.GetKind()
 	group := strings.Split(obj.GetAPIVersion(), "/")[0]
 	if strings.HasSuffix(group, "crossplane.io") || strings.HasSuffix(group, "upbound.io") {
@@ -209,18 +314,23 @@ func GetDefaultHealth(obj *unstructured.Unstructured) (*HealthStatus, error) {
 	if strings.Contains(group, "cnrm.cloud.google.com") {
 		kind = "cnrm.cloud.google.com"
 	}
-	if statusMap, ok := statusByKind[obj.GetAPIVersion()+"/"+obj.GetKind()]; ok {
-		return GetHealth(obj, statusMap)
-	} else if statusMap, ok := statusByKind[kind]; ok {
-		return GetHealth(obj, statusMap)
-	} else {
-		return GetHealth(obj, statusByKind["default"])
-	}
+	statusMap, key, _ := getStatusMap(
+		obj.GetAPIVersion()+"/"+obj.GetKind(),
+		group+"/"+obj.GetKind(),
+		kind,
+		"default",
+	)
+	t.add(TraceSourceStatusMap, "using status map %s", key)
+	return getHealth(obj, statusMap, t)
 }
 
 func GetHealth(obj *unstructured.Unstructured, statusMap StatusMap) (*HealthStatus, error) {
+	return getHealth(obj, statusMap, nil)
+}
+
+func getHealth(obj *unstructured.Unstructured, statusMap StatusMap, t *tracer) (*HealthStatus, error) {
 	if len(statusMap.Filters) > 0 {
-		for _, f := range statusMap.Filters {
+		for i, f := range statusMap.Filters {
 			allGot := true
 			for k, v := range f.Match {
 				got, _, _ := unstructured.NestedString(obj.Object, strings.Split(k, ".")...)
@@ -229,41 +339,80 @@ func GetHealth(obj *unstructured.Unstructured, statusMap StatusMap) (*HealthStat
 					continue
 				}
 			}
+			if allGot && f.Expr != "" {
+				matched, err := matchExpression(f.Expr, obj.Object, t, TraceSourceFilter)
+				if err != nil {
+					return nil, err
+				}
+				t.add(TraceSourceFilter, "filters[%d] %s evaluated to %t", i, f.Expr, matched)
+				allGot = matched
+			}
 			if allGot {
 				health := &HealthStatus{
 					Health: HealthUnknown,
 				}
+				before := *health
 				f.OnCondition.Apply(health, &metav1.Condition{})
+				t.changed(TraceSourceFilter, fmt.Sprintf("filters[%d] matched %v", i, f.Match), before, *health)
 				return health, nil
 			}
 		}
 	}
-	return GetHealthFromStatus(GetGenericStatus(obj), statusMap)
+	return getHealthFromStatus(obj.Object, GetGenericStatus(obj), statusMap, t)
 }
 
 func GetHealthFromStatus(k GenericStatus, statusMap StatusMap) (*HealthStatus, error) {
+	return getHealthFromStatus(nil, k, statusMap, nil)
+}
+
+func getHealthFromStatus(
+	obj map[string]any,
+	k GenericStatus,
+	statusMap StatusMap,
+	t *tracer,
+) (*HealthStatus, error) {
 	health := &HealthStatus{
 		Health: HealthUnknown,
 	}
 	if len(statusMap.Conditions) == 0 {
+		t.add(TraceSourceStatusMap, "no conditions are mapped")
 		return health, nil
 	}
 
 	for _, condition := range k.Conditions {
 		mappedCondition, ok := statusMap.Conditions[condition.Type]
+		if ok && mappedCondition.Expr != "" {
+			vars := conditionVars(obj, condition)
+			matched, err := matchExpression(mappedCondition.Expr, vars, t, TraceSourceCondition)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				t.add(TraceSourceCondition, "%s=%s ignored, %s is false", condition.Type, condition.Status,
+					mappedCondition.Expr)
+				continue
+			}
+		}
 		if ok {
-			mappedCondition.Apply(health, &condition)
+			mappedCondition.apply(health, &condition, t)
+		} else {
+			t.add(TraceSourceCondition, "%s=%s ignored, not in status map", condition.Type, condition.Status)
 		}
 	}
 
 	if statusMap.UnhealthyIsNotReady && health.Health != HealthHealthy {
+		t.add(TraceSourceStatusMap, "unhealthyIsNotReady: ready=false")
 		health.Ready = false
 	}
 
 	return health, nil
 }
 
+// ListResourceTypes returns the kinds with a status map and the types of every registered health check
 func ListResourceTypes() []string {
+	statusByKindLock.RLock()
+	defer statusByKindLock.RUnlock()
+
 	types := []string{}
 	for k := range statusByKind {
 		if k == "default" {
@@ -271,5 +420,20 @@ func ListResourceTypes() []string {
 		}
 		types = append(types, k)
 	}
-	return types
+	return append(types, listRegisteredTypes()...)
+}
+
+// conditionVars exposes the object and the condition being mapped to an expression
+func conditionVars(obj map[string]any, c metav1.Condition) map[string]any {
+	vars := make(map[string]any, len(obj)+1)
+	for k, v := range obj {
+		vars[k] = v
+	}
+	vars["condition"] = map[string]any{
+		"type":    c.Type,
+		"status":  string(c.Status),
+		"reason":  c.Reason,
+		"message": c.Message,
+	}
+	return vars
 }
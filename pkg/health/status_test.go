@@ -0,0 +1,207 @@
+package health_test
+
+import (
+	"testing"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadStatusMaps(t *testing.T) {
+	t.Cleanup(health.SnapshotStatusMaps())
+	require.NoError(t, health.LoadStatusMaps([]byte(`
+platform.example.com/v1/Database:
+  conditions:
+    Provisioned:
+      ready: true
+      health: healthy
+      onFalse:
+        health: warning
+        message: true
+# reuse the flux mapping of the built-in statusMap.yaml
+platform.example.com/Release: *flux
+`), []byte(`
+---
+platform.example.com/v1/Database:
+  conditions:
+    Degraded:
+      health: unhealthy
+      message: true
+      order: 1
+`)))
+
+	objs := parseObjects(t, `
+apiVersion: platform.example.com/v1
+kind: Database
+metadata:
+  name: orders
+status:
+  conditions:
+  - type: Provisioned
+    status: "True"
+    reason: Provisioned
+  - type: Degraded
+    status: "True"
+    reason: ReplicaLag
+    message: replica is 5m behind
+`, `
+apiVersion: platform.example.com/v2
+kind: Release
+metadata:
+  name: orders
+status:
+  conditions:
+  - type: Ready
+    status: "False"
+    reason: UpgradeFailed
+    message: upgrade failed
+`, `
+apiVersion: platform.example.com/v2
+kind: Database
+metadata:
+  name: orders
+status:
+  conditions:
+  - type: Degraded
+    status: "True"
+    reason: ReplicaLag
+`)
+
+	hr, err := health.GetResourceHealth(objs[0], nil)
+	require.NoError(t, err)
+	assert.Equal(t, health.HealthUnhealthy, hr.Health)
+	assert.Equal(t, health.HealthStatusCode("ReplicaLag"), hr.Status)
+	assert.Equal(t, "replica is 5m behind", hr.Message)
+	assert.True(t, hr.Ready)
+
+	hr, err = health.GetResourceHealth(objs[1], nil)
+	require.NoError(t, err)
+	assert.Equal(t, health.HealthUnhealthy, hr.Health)
+	assert.Equal(t, health.HealthStatusCode("UpgradeFailed"), hr.Status)
+
+	// only registered for v1
+	hr, err = health.GetResourceHealth(objs[2], nil)
+	require.NoError(t, err)
+	assert.Equal(t, health.HealthUnknown, hr.Health)
+
+	assert.Contains(t, health.ListResourceTypes(), "platform.example.com/v1/Database")
+	assert.Error(t, health.LoadStatusMaps([]byte(`Broken: *missing`)))
+}
+
+func TestLoadStatusMapsDocuments(t *testing.T) {
+	t.Cleanup(health.SnapshotStatusMaps())
+	require.NoError(t, health.LoadStatusMaps([]byte(`--- # first
+documents.example.com/First: &first
+  conditions:
+    Ready:
+      ready: true
+      health: healthy
+...
+--- # second
+documents.example.com/Second: *first
+`), []byte(`documents.example.com/Third: *first`)))
+
+	for _, key := range []string{
+		"documents.example.com/First",
+		"documents.example.com/Second",
+		"documents.example.com/Third",
+	} {
+		statusMap, ok := health.GetStatusMap(key)
+		require.True(t, ok, key)
+		assert.Equal(t, health.HealthHealthy, statusMap.Conditions["Ready"].Health, key)
+	}
+}
+
+func TestStatusMapExpressions(t *testing.T) {
+	t.Cleanup(health.SnapshotStatusMaps())
+	require.NoError(t, health.LoadStatusMaps([]byte(`
+expr.example.com/Cluster:
+  filters:
+    - expr: has(spec.paused) && spec.paused
+      status: Paused
+      health: unknown
+    - expr: status.readyNodes < spec.nodes
+      status: ScalingUp
+      health: warning
+  conditions:
+    Ready:
+      expr: condition.reason != "Initializing" && status.observedGeneration == metadata.generation
+      ready: true
+      health: healthy
+`)))
+
+	objs := parseObjects(t, `
+apiVersion: expr.example.com/v1
+kind: Cluster
+metadata:
+  name: scaling
+  generation: 2
+spec:
+  nodes: 3
+status:
+  readyNodes: 2
+`, `
+apiVersion: expr.example.com/v1
+kind: Cluster
+metadata:
+  name: paused
+spec:
+  paused: true
+  nodes: 3
+`, `
+apiVersion: expr.example.com/v1
+kind: Cluster
+metadata:
+  name: ready
+  generation: 2
+spec:
+  nodes: 3
+status:
+  readyNodes: 3
+  observedGeneration: 2
+  conditions:
+  - type: Ready
+    status: "True"
+    reason: Available
+`, `
+apiVersion: expr.example.com/v1
+kind: Cluster
+metadata:
+  name: stale
+  generation: 3
+spec:
+  nodes: 3
+status:
+  readyNodes: 3
+  observedGeneration: 2
+  conditions:
+  - type: Ready
+    status: "True"
+    reason: Available
+`, `
+apiVersion: expr.example.com/v1
+kind: Cluster
+metadata:
+  name: new
+spec:
+  nodes: 3
+`)
+
+	for i, expected := range []struct {
+		health health.Health
+		status health.HealthStatusCode
+	}{
+		{health.HealthWarning, "ScalingUp"},
+		{health.HealthUnknown, "Paused"},
+		{health.HealthHealthy, "Available"},
+		{health.HealthUnknown, ""},
+		// the filters referencing the missing status do not match
+		{health.HealthUnknown, ""},
+	} {
+		hr, err := health.GetResourceHealth(objs[i], nil)
+		require.NoError(t, err)
+		assert.Equal(t, expected.health, hr.Health, objs[i].GetName())
+		assert.Equal(t, expected.status, hr.Status, objs[i].GetName())
+	}
+}
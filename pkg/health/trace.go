@@ -0,0 +1,77 @@
+package health
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Sources of the decisions recorded in a trace
+const (
+	TraceSourceGo          = "go"
+	TraceSourceOverride    = "override"
+	TraceSourceStatusMap   = "statusMap"
+	TraceSourceFilter      = "filter"
+	TraceSourceCondition   = "condition"
+	TraceSourceDefault     = "default"
+	TraceSourceTerminating = "terminating"
+)
+
+// TraceStep is a single decision taken while evaluating the health of a resource
+type TraceStep struct {
+	Source  string `json:"source"`
+	Message string `json:"message"`
+}
+
+func (s TraceStep) String() string {
+	return fmt.Sprintf("[%s] %s", s.Source, s.Message)
+}
+
+// tracer collects trace steps, all methods are no-ops on a nil tracer so that tracing is free when disabled
+type tracer struct {
+	steps []TraceStep
+}
+
+func (t *tracer) add(source, msg string, args ...any) {
+	if t == nil {
+		return
+	}
+	t.steps = append(t.steps, TraceStep{Source: source, Message: fmt.Sprintf(msg, args...)})
+}
+
+// changed records the fields that differ between before and after
+func (t *tracer) changed(source, label string, before, after HealthStatus) {
+	if t == nil {
+		return
+	}
+
+	var changes []string
+	if before.Health != after.Health {
+		changes = append(changes, fmt.Sprintf("health=%s", after.Health))
+	}
+	if before.Status != after.Status {
+		changes = append(changes, fmt.Sprintf("status=%s", after.Status))
+	}
+	if before.Ready != after.Ready {
+		changes = append(changes, fmt.Sprintf("ready=%t", after.Ready))
+	}
+	if before.Message != after.Message {
+		changes = append(changes, fmt.Sprintf("message=%q", after.Message))
+	}
+
+	if len(changes) == 0 {
+		t.add(source, "%s: no change", label)
+	} else {
+		t.add(source, "%s: %s", label, strings.Join(changes, ", "))
+	}
+}
+
+func describe(hs HealthStatus) string {
+	return fmt.Sprintf("health=%s, status=%s, ready=%t", hs.Health, hs.Status, hs.Ready)
+}
+
+func funcName(fn any) string {
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	return name[strings.LastIndex(name, "/")+1:]
+}
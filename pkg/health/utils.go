@@ -18,6 +18,7 @@ const (
 	ServiceKind                  = "Service"
 	ServiceAccountKind           = "ServiceAccount"
 	EndpointsKind                = "Endpoints"
+	EndpointSliceKind            = "EndpointSlice"
 	DeploymentKind               = "Deployment"
 	ReplicaSetKind               = "ReplicaSet"
 	StatefulSetKind              = "StatefulSet"
@@ -26,11 +27,17 @@ const (
 	JobKind                      = "Job"
 	CronJobKind                  = "CronJob"
 	PersistentVolumeClaimKind    = "PersistentVolumeClaim"
+	PersistentVolumeKind         = "PersistentVolume"
+	StorageClassKind             = "StorageClass"
+	VolumeAttachmentKind         = "VolumeAttachment"
 	CustomResourceDefinitionKind = "CustomResourceDefinition"
 	PodKind                      = "Pod"
 	APIServiceKind               = "APIService"
 	NamespaceKind                = "Namespace"
 	HorizontalPodAutoscalerKind  = "HorizontalPodAutoscaler"
+	PodDisruptionBudgetKind      = "PodDisruptionBudget"
+	ResourceQuotaKind            = "ResourceQuota"
+	LimitRangeKind               = "LimitRange"
 )
 
 type HealthStatus struct {
@@ -46,6 +53,8 @@ type HealthStatus struct {
 	// LastUpdated is the time this resource as last updated, detected by inspecting all
 	// of the relevant status timestamps
 	LastUpdated *time.Time `json:"lastUpdated,omitempty"`
+	// Trace lists the decisions that produced this status, only populated when requested via Options.Trace
+	Trace []TraceStep `json:"trace,omitempty"`
 
 	order int `json:"-" yaml:"-"`
 }
@@ -211,7 +220,12 @@ func GetStartDeadline(containers ...corev1.Container) time.Duration {
 }
 
 func IsContainerStarting(creation time.Time, containers ...corev1.Container) bool {
-	return time.Since(creation) < GetStartDeadline(containers...)
+	return IsContainerStartingAt(time.Now(), creation, containers...)
+}
+
+// IsContainerStartingAt returns true if the containers are still within their start deadline as of now
+func IsContainerStartingAt(now, creation time.Time, containers ...corev1.Container) bool {
+	return now.Sub(creation) < GetStartDeadline(containers...)
 }
 
 func HumanCase(s string) string {
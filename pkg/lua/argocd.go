@@ -0,0 +1,103 @@
+package lua
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// argoCDCustomizationsKey is the legacy argocd-cm key holding every customization in a single YAML blob
+	argoCDCustomizationsKey = "resource.customizations"
+	// argoCDCustomizationsPrefix prefixes the resource.customizations.<field>.<group>_<kind> argocd-cm keys
+	argoCDCustomizationsPrefix = argoCDCustomizationsKey + "."
+)
+
+// ParseArgoCDConfigMap returns the resource customizations of the data of an argocd-cm ConfigMap, read from both
+// the legacy resource.customizations blob and the resource.customizations.<field>.<group>_<kind> keys, the latter
+// taking precedence. Keys of the core group omit the group (e.g. resource.customizations.health.Service), group and
+// kind can be wildcards (e.g. resource.customizations.health.*.crossplane.io_*) and the "all" group kind of the
+// ignoreDifferences and ignoreResourceUpdates fields matches every resource.
+func ParseArgoCDConfigMap(data map[string]string) (ResourceHealthOverrides, error) {
+	overrides := ResourceHealthOverrides{}
+	if blob, ok := data[argoCDCustomizationsKey]; ok {
+		legacy, err := ParseArgoCDResourceCustomizations(blob)
+		if err != nil {
+			return nil, err
+		}
+		overrides = legacy
+	}
+
+	// sorted for deterministic errors
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		if strings.HasPrefix(k, argoCDCustomizationsPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		field, groupKind, ok := strings.Cut(strings.TrimPrefix(k, argoCDCustomizationsPrefix), ".")
+		if !ok || groupKind == "" {
+			return nil, fmt.Errorf("invalid key %s, expected %s<field>.<group>_<kind>", k, argoCDCustomizationsPrefix)
+		}
+		key := argoCDOverrideKey(field, groupKind)
+		override := overrides[key]
+		if err := override.setArgoCDField(field, data[k]); err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		overrides[key] = override
+	}
+	return overrides, nil
+}
+
+// ParseArgoCDResourceCustomizations parses the legacy resource.customizations YAML blob of argocd-cm, a map of
+// <group>/<kind> to the health.lua, health.lua.useOpenLibs, actions, ignoreDifferences, ignoreResourceUpdates and
+// knownTypeFields of the kind
+func ParseArgoCDResourceCustomizations(blob string) (ResourceHealthOverrides, error) {
+	overrides := ResourceHealthOverrides{}
+	if err := yaml.Unmarshal([]byte(blob), &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", argoCDCustomizationsKey, err)
+	}
+	return overrides, nil
+}
+
+// argoCDOverrideKey converts the <group>_<kind> of an argocd-cm key to the <group>/<kind> key of the overrides
+func argoCDOverrideKey(field, groupKind string) string {
+	if groupKind == "all" && (field == "ignoreDifferences" || field == "ignoreResourceUpdates") {
+		return "*/*"
+	}
+	// groups are DNS subdomains and kinds are CamelCase, neither contain an underscore
+	if i := strings.LastIndex(groupKind, "_"); i >= 0 {
+		return groupKind[:i] + "/" + groupKind[i+1:]
+	}
+	return groupKind
+}
+
+func (s *ResourceOverride) setArgoCDField(field, value string) error {
+	switch field {
+	case "health":
+		s.HealthLua = value
+	case "useOpenLibs":
+		useOpenLibs, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return err
+		}
+		s.UseOpenLibs = useOpenLibs
+	case "actions":
+		s.Actions = value
+	case "ignoreDifferences":
+		return yaml.Unmarshal([]byte(value), &s.IgnoreDifferences)
+	case "ignoreResourceUpdates":
+		return yaml.Unmarshal([]byte(value), &s.IgnoreResourceUpdates)
+	case "knownTypeFields":
+		return yaml.Unmarshal([]byte(value), &s.KnownTypeFields)
+	default:
+		return fmt.Errorf("unsupported resource customization %s", field)
+	}
+	return nil
+}
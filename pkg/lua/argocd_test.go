@@ -0,0 +1,102 @@
+package lua
+
+import (
+	"testing"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const legacyResourceCustomizations = `
+example.com/Widget:
+  health.lua: |
+    return {status = "Degraded", message = "legacy"}
+  ignoreDifferences: |
+    jsonPointers:
+    - /spec/replicas
+example.com/Gadget:
+  health.lua.useOpenLibs: true
+  health.lua: |
+    return {status = "Healthy", message = string.upper(obj.kind)}
+  actions: |
+    discovery.lua: |
+      return {restart = {}}
+    definitions:
+    - name: restart
+      action.lua: |
+        obj.spec = {restarted = true}
+        return obj
+`
+
+func TestParseArgoCDConfigMap(t *testing.T) {
+	overrides, err := ParseArgoCDConfigMap(map[string]string{
+		"url":                     "https://argocd.example.com",
+		"resource.customizations": legacyResourceCustomizations,
+		// the split keys take precedence over the legacy blob
+		"resource.customizations.health.example.com_Widget": `return {status = "Healthy", message = "split"}`,
+		"resource.customizations.health.*.crossplane.io_*":  `return {status = "Progressing", message = obj.kind}`,
+		"resource.customizations.health.ConfigMap":          `return {status = "Degraded", message = "core"}`,
+		"resource.customizations.useOpenLibs.ConfigMap":     "true",
+		"resource.customizations.ignoreDifferences.all": `managedFieldsManagers:
+- kube-controller-manager`,
+		"resource.customizations.knownTypeFields.apps_Deployment": `- field: spec.template.spec
+  type: core/v1/PodSpec`,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, `return {status = "Healthy", message = "split"}`, overrides["example.com/Widget"].HealthLua)
+	assert.Equal(t, []string{"/spec/replicas"}, overrides["example.com/Widget"].IgnoreDifferences.JSONPointers)
+	assert.True(t, overrides["example.com/Gadget"].UseOpenLibs)
+	assert.True(t, overrides["ConfigMap"].UseOpenLibs)
+	assert.Equal(t, []string{"kube-controller-manager"}, overrides["*/*"].IgnoreDifferences.ManagedFieldsManagers)
+	assert.Equal(t, []KnownTypeField{{Field: "spec.template.spec", Type: "core/v1/PodSpec"}},
+		overrides["apps/Deployment"].KnownTypeFields)
+
+	for _, test := range []struct {
+		apiVersion, kind string
+		health           health.Health
+		message          string
+	}{
+		{"example.com/v1", "Widget", health.HealthHealthy, "split"},
+		{"example.com/v1", "Gadget", health.HealthHealthy, "GADGET"},
+		{"s3.aws.crossplane.io/v1beta1", "Bucket", health.HealthUnknown, "Bucket"},
+		{"v1", "ConfigMap", health.HealthUnhealthy, "core"},
+	} {
+		obj := StrToUnstructured(`{"apiVersion": "` + test.apiVersion + `", "kind": "` + test.kind +
+			`", "metadata": {"name": "test"}}`)
+		status, err := overrides.GetResourceHealth(obj)
+		require.NoError(t, err, test.kind)
+		require.NotNil(t, status, test.kind)
+		assert.Equal(t, test.health, status.Health, test.kind)
+		assert.Equal(t, test.message, status.Message, test.kind)
+	}
+
+	vm := VM{ResourceOverrides: overrides}
+	assert.Equal(t, "*.crossplane.io/*",
+		GetWildcardConfigMapKey(vm, schema.GroupVersionKind{Group: "s3.aws.crossplane.io", Kind: "Bucket"}))
+	assert.Len(t, overrides.GetIgnoreDifferences(schema.GroupVersionKind{Group: "example.com", Kind: "Widget"}), 2)
+
+	gadget := StrToUnstructured(`{"apiVersion": "example.com/v1", "kind": "Gadget", "metadata": {"name": "test"}}`)
+	discovery, err := vm.GetResourceActionDiscovery(gadget)
+	require.NoError(t, err)
+	actions, err := vm.ExecuteResourceActionDiscovery(gadget, discovery)
+	require.NoError(t, err)
+	assert.Equal(t, []ResourceAction{{Name: "restart"}}, actions)
+	action, err := vm.GetResourceAction(gadget, "restart")
+	require.NoError(t, err)
+	impacted, err := vm.ExecuteResourceAction(gadget, action.ActionLua)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"restarted": true}, impacted[0].UnstructuredObj.Object["spec"])
+
+	for name, data := range map[string]map[string]string{
+		"missing group kind": {"resource.customizations.health": "return {}"},
+		"unknown field":      {"resource.customizations.readiness.Service": "return {}"},
+		"invalid bool":       {"resource.customizations.useOpenLibs.Service": "yes please"},
+		"invalid blob":       {"resource.customizations": "- not a map"},
+	} {
+		_, err := ParseArgoCDConfigMap(data)
+		assert.Error(t, err, name)
+	}
+}
@@ -8,28 +8,12 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/yaml"
 )
 
-type ActionTestStructure struct {
-	DiscoveryTests []IndividualDiscoveryTest `yaml:"discoveryTests"`
-	ActionTests    []IndividualActionTest    `yaml:"actionTests"`
-}
-
-type IndividualDiscoveryTest struct {
-	InputPath string           `yaml:"inputPath"`
-	Result    []ResourceAction `yaml:"result"`
-}
-
-type IndividualActionTest struct {
-	Action             string `yaml:"action"`
-	InputPath          string `yaml:"inputPath"`
-	ExpectedOutputPath string `yaml:"expectedOutputPath"`
-	InputStr           string `yaml:"input"`
-}
-
 func TestLuaResourceActionsScript(t *testing.T) {
 	err := filepath.Walk("../resource_customizations", func(path string, f os.FileInfo, err error) error {
 		if !strings.Contains(path, "action_test.yaml") {
@@ -76,8 +60,23 @@ func TestLuaResourceActionsScript(t *testing.T) {
 
 				assert.NoError(t, err)
 
-				assert.NoError(t, err)
-				impactedResources, err := vm.ExecuteResourceAction(sourceObj, action.ActionLua)
+				var params []ResourceActionParam
+				if len(test.Parameters) > 0 {
+					discoveryLua, err := vm.GetResourceActionDiscovery(sourceObj)
+					assert.NoError(t, err)
+					discovered, err := vm.ExecuteResourceActionDiscovery(sourceObj, discoveryLua)
+					assert.NoError(t, err)
+					resourceAction, found := lo.Find(discovered, func(a ResourceAction) bool {
+						return a.Name == test.Action
+					})
+					if !assert.True(t, found, "action %s is not discovered", test.Action) {
+						return
+					}
+					params, err = resourceAction.ResolveParams(test.Parameters)
+					assert.NoError(t, err)
+				}
+
+				impactedResources, err := vm.ExecuteResourceAction(sourceObj, action.ActionLua, params...)
 				assert.NoError(t, err)
 
 				// Treat the Lua expected output as a list
@@ -0,0 +1,231 @@
+package lua
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/flanksource/is-healthy/pkg/resource_customizations"
+)
+
+var (
+	customizationDirsLock sync.RWMutex
+	// customizationDirs are layered over the embedded customizations, the last loaded directory takes precedence
+	customizationDirs []*CustomizationsDir
+)
+
+// CustomizationsDir is a directory of resource customizations laid out like the embedded ones, i.e.
+// <group>/<Kind>/health.lua, <group>/<Kind>/actions/discovery.lua and <group>/<Kind>/actions/<action>/action.lua.
+// Its scripts override the embedded scripts of the same group and kind, and extend them with new kinds.
+// Directory names can use wildcards, e.g. *.crossplane.io/*/health.lua, which are used for the kinds without a
+// script of their own.
+type CustomizationsDir struct {
+	Path string
+
+	lock  sync.RWMutex
+	files map[string][]byte
+}
+
+// LoadCustomizationsDir reads the lua scripts of the directory and layers them over the embedded customizations
+func LoadCustomizationsDir(dir string) (*CustomizationsDir, error) {
+	d := &CustomizationsDir{Path: dir}
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+	load(d)
+	return d, nil
+}
+
+func load(d *CustomizationsDir) {
+	customizationDirsLock.Lock()
+	defer customizationDirsLock.Unlock()
+	customizationDirs = append(customizationDirs, d)
+}
+
+// Unload removes the directory from the customizations
+func (d *CustomizationsDir) Unload() {
+	customizationDirsLock.Lock()
+	defer customizationDirsLock.Unlock()
+	customizationDirs = slices.DeleteFunc(customizationDirs, func(dir *CustomizationsDir) bool { return dir == d })
+}
+
+// Reload reads the lua scripts of the directory again, the previous scripts are kept on failure
+func (d *CustomizationsDir) Reload() error {
+	files := map[string][]byte{}
+	err := filepath.WalkDir(d.Path, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == "testdata" {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() || filepath.Ext(p) != ".lua" {
+			return nil
+		}
+		rel, err := filepath.Rel(d.Path, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load the resource customizations of %s: %w", d.Path, err)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.files = files
+	return nil
+}
+
+// Watch reloads the directory on changes until the context is done, onReload is called with the result of every
+// reload and can be nil
+func (d *CustomizationsDir) Watch(ctx context.Context, onReload func(error)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watchTree(watcher, d.Path); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			var err error
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Create) {
+					// fsnotify does not watch recursively, new directories are added explicitly
+					if info, statErr := os.Stat(event.Name); statErr == nil && info.IsDir() {
+						err = watchTree(watcher, event.Name)
+					}
+				}
+				if err == nil {
+					err = d.Reload()
+				}
+			case watchErr, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				err = watchErr
+			}
+			if onReload != nil {
+				onReload(err)
+			}
+		}
+	}()
+	return nil
+}
+
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return err
+		}
+		return watcher.Add(p)
+	})
+}
+
+// readFile returns the script at the slash separated path and the path of the file it was read from, matching
+// wildcard directories if exact is false
+func (d *CustomizationsDir) readFile(p string, exact bool) ([]byte, string, bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if exact {
+		data, ok := d.files[p]
+		return data, d.source(p), ok
+	}
+	for _, pattern := range sortedKeys(d.files) {
+		if strings.ContainsAny(pattern, "*?[{") && Match(pattern, p, '/') {
+			return d.files[pattern], d.source(pattern), true
+		}
+	}
+	return nil, "", false
+}
+
+// source names the file at the slash separated path, the files of OCI artifacts are named after their reference
+func (d *CustomizationsDir) source(p string) string {
+	if strings.HasPrefix(d.Path, OCIScheme) {
+		return d.Path + "/" + p
+	}
+	return filepath.Join(d.Path, filepath.FromSlash(p))
+}
+
+// resourceTypes returns the <group>/<Kind> of the directory
+func (d *CustomizationsDir) resourceTypes() []string {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	var types []string
+	for p := range d.files {
+		if dir, _, ok := strings.Cut(p, "/actions/"); ok {
+			types = append(types, dir)
+		} else if strings.Count(p, "/") == 2 {
+			types = append(types, path.Dir(p))
+		}
+	}
+	return types
+}
+
+func sortedKeys(files map[string][]byte) []string {
+	keys := make([]string, 0, len(files))
+	for k := range files {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// readCustomization returns the script at the slash separated path from the customization directories, the
+// embedded customizations and then the wildcards of the customization directories, or nil if there is none. The
+// source names the file the script was read from.
+func readCustomization(p string) (data []byte, source string, err error) {
+	customizationDirsLock.RLock()
+	dirs := slices.Clone(customizationDirs)
+	customizationDirsLock.RUnlock()
+	slices.Reverse(dirs)
+
+	for _, dir := range dirs {
+		if data, source, ok := dir.readFile(p, true); ok {
+			return data, source, nil
+		}
+	}
+
+	data, err = resource_customizations.Embedded.ReadFile(p)
+	if err == nil {
+		return data, embeddedSource(p), nil
+	} else if !os.IsNotExist(err) {
+		return nil, "", err
+	}
+
+	for _, dir := range dirs {
+		if data, source, ok := dir.readFile(p, false); ok {
+			return data, source, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// embeddedSource names a script of the embedded customizations
+func embeddedSource(p string) string {
+	return "embedded:" + p
+}
@@ -0,0 +1,100 @@
+package lua
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeScript(t *testing.T, dir, name, script string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(script), 0o600))
+}
+
+func healthScript(status string) string {
+	return `return {status = "` + status + `", message = obj.kind}`
+}
+
+func TestCustomizationsDir(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "example.com/Widget/health.lua", healthScript("Healthy"))
+	writeScript(t, dir, "argoproj.io/Rollout/health.lua", healthScript("Suspended"))
+	writeScript(t, dir, "*.crossplane.example.com/*/health.lua", healthScript("Degraded"))
+	writeScript(t, dir, "argoproj.io/*/health.lua", healthScript("Degraded"))
+	writeScript(t, dir, "example.com/Widget/actions/discovery.lua", `return {restart = {}}`)
+	writeScript(t, dir, "example.com/Widget/actions/restart/action.lua", `obj.spec = {restarted = true}
+return obj`)
+	writeScript(t, dir, "example.com/Widget/testdata/broken.lua", `return {`)
+
+	customizations, err := LoadCustomizationsDir(dir)
+	require.NoError(t, err)
+	defer customizations.Unload()
+
+	overrides := ResourceHealthOverrides{}
+	for _, test := range []struct {
+		apiVersion, kind string
+		health           health.Health
+	}{
+		{"example.com/v1", "Widget", health.HealthHealthy},
+		// overrides the embedded script
+		{"argoproj.io/v1alpha1", "Rollout", health.HealthUnknown},
+		{"s3.crossplane.example.com/v1", "Bucket", health.HealthUnhealthy},
+		{"argoproj.io/v1alpha1", "Sensor", health.HealthUnhealthy},
+		// embedded scripts take precedence over wildcards
+		{"argoproj.io/v1alpha1", "AnalysisRun", health.HealthUnknown},
+	} {
+		obj := StrToUnstructured(`{"apiVersion": "` + test.apiVersion + `", "kind": "` + test.kind +
+			`", "metadata": {"name": "test"}}`)
+		status, err := overrides.GetResourceHealth(obj)
+		require.NoError(t, err, test.kind)
+		require.NotNil(t, status, test.kind)
+		assert.Equal(t, test.health, status.Health, test.kind)
+	}
+
+	widget := StrToUnstructured(`{"apiVersion": "example.com/v1", "kind": "Widget", "metadata": {"name": "test"}}`)
+	vm := VM{}
+	discovery, err := vm.GetResourceActionDiscovery(widget)
+	require.NoError(t, err)
+	actions, err := vm.ExecuteResourceActionDiscovery(widget, discovery)
+	require.NoError(t, err)
+	assert.Equal(t, []ResourceAction{{Name: "restart"}}, actions)
+	action, err := vm.GetResourceAction(widget, "restart")
+	require.NoError(t, err)
+	impacted, err := vm.ExecuteResourceAction(widget, action.ActionLua)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"restarted": true}, impacted[0].UnstructuredObj.Object["spec"])
+
+	assert.Contains(t, ListResourceTypes(), "example.com/Widget")
+	assert.Contains(t, ListResourceTypes(), "*.crossplane.example.com/*")
+
+	t.Run("reload", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var reloads atomic.Int32
+		require.NoError(t, customizations.Watch(ctx, func(err error) {
+			if err == nil {
+				reloads.Add(1)
+			}
+		}))
+
+		writeScript(t, dir, "example.com/Gadget/health.lua", healthScript("Healthy"))
+		gadget := StrToUnstructured(`{"apiVersion": "example.com/v1", "kind": "Gadget", "metadata": {"name": "test"}}`)
+		assert.Eventually(t, func() bool {
+			status, err := overrides.GetResourceHealth(gadget)
+			return err == nil && status != nil && status.Health == health.HealthHealthy
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Positive(t, reloads.Load())
+	})
+
+	customizations.Unload()
+	status, err := overrides.GetResourceHealth(widget)
+	require.NoError(t, err)
+	assert.Nil(t, status)
+}
@@ -0,0 +1,156 @@
+package lua
+
+import (
+	"encoding/json"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	luajson "layeh.com/gopher-json"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+)
+
+// HealthLibName is the name of the module returned by require("health"), which exposes the helpers of the Go health
+// checks to the lua scripts so that they do not re-implement condition lookups and timestamp parsing:
+//
+//	local health = require("health")
+//	local ready = health.findCondition(obj, "Ready")
+//	if ready ~= nil and ready.status == "False" then
+//	  return {status = "Degraded", message = ready.message}
+//	end
+const HealthLibName = "health"
+
+// healthLoader returns the loader of the health module using now as the current time of health.age()
+func healthLoader(now func() time.Time) lua.LGFunction {
+	return func(L *lua.LState) int {
+		L.Push(L.SetFuncs(L.NewTable(), healthFuncs(now)))
+		return 1
+	}
+}
+
+func healthFuncs(now func() time.Time) map[string]lua.LGFunction {
+	return map[string]lua.LGFunction{
+		"findCondition":        healthFindCondition,
+		"fromStatusName":       healthFromStatusName,
+		"statusMap":            healthStatusMap,
+		"humanCase":            healthHumanCase,
+		"parseTime":            healthParseTime,
+		"age":                  func(L *lua.LState) int { return healthAge(L, now) },
+		"isGenerationObserved": healthIsGenerationObserved,
+	}
+}
+
+// healthFindCondition returns the status.conditions entry of obj with the type, or nil
+//
+//	health.findCondition(obj, "Ready") -> {type, status, reason, message, lastTransitionTime, observedGeneration}
+func healthFindCondition(L *lua.LState) int {
+	obj := checkObject(L, 1)
+	condition := health.GetGenericStatus(obj).FindCondition(L.CheckString(2))
+	if condition.Type == "" {
+		L.Push(lua.LNil)
+		return 1
+	}
+	L.Push(toLua(L, condition))
+	return 1
+}
+
+// healthFromStatusName returns the health of a status name such as "CREATE_FAILED", see
+// health.GetHealthFromStatusName
+//
+//	health.fromStatusName(status, reason...) -> {health, status, ready, message}
+func healthFromStatusName(L *lua.LState) int {
+	var reasons []string
+	for i := 2; i <= L.GetTop(); i++ {
+		reasons = append(reasons, L.CheckString(i))
+	}
+	L.Push(toLua(L, health.GetHealthFromStatusName(L.CheckString(1), reasons...)))
+	return 1
+}
+
+// healthStatusMap evaluates obj with the loaded status map of the name, a Kind, a group/Kind or an apiVersion/Kind
+//
+//	health.statusMap("Kustomization", obj) -> {health, status, ready, message}
+func healthStatusMap(L *lua.LState) int {
+	name := L.CheckString(1)
+	obj := checkObject(L, 2)
+	statusMap, ok := health.GetStatusMap(name)
+	if !ok {
+		L.ArgError(1, "no status map "+name)
+	}
+	status, err := health.GetHealth(obj, statusMap)
+	if err != nil {
+		L.RaiseError("status map %s: %s", name, err.Error())
+	}
+	L.Push(toLua(L, status))
+	return 1
+}
+
+// healthHumanCase returns the string in human case, e.g. "Human Case" for "humanCase" or "HUMAN_CASE"
+func healthHumanCase(L *lua.LState) int {
+	L.Push(lua.LString(health.HumanCase(L.CheckString(1))))
+	return 1
+}
+
+// healthParseTime returns the unix time of an RFC3339 timestamp, or nil and the error
+func healthParseTime(L *lua.LState) int {
+	t, err := time.Parse(time.RFC3339, L.CheckString(1))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LNumber(t.Unix()))
+	return 1
+}
+
+// healthAge returns the seconds elapsed since an RFC3339 timestamp, or nil and the error
+func healthAge(L *lua.LState, now func() time.Time) int {
+	t, err := time.Parse(time.RFC3339, L.CheckString(1))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LNumber(now().Sub(t).Seconds()))
+	return 1
+}
+
+// healthIsGenerationObserved returns true if status.observedGeneration of obj is at least its metadata.generation
+func healthIsGenerationObserved(L *lua.LState) int {
+	obj := checkObject(L, 1)
+	observedGeneration, ok, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	L.Push(lua.LBool(ok && observedGeneration >= obj.GetGeneration()))
+	return 1
+}
+
+// checkObject returns the table argument n as an object
+func checkObject(L *lua.LState, n int) *unstructured.Unstructured {
+	data, err := luajson.Encode(L.CheckTable(n))
+	if err != nil {
+		L.ArgError(n, err.Error())
+	}
+	var obj map[string]any
+	// empty tables are encoded as arrays
+	if string(data) != "[]" {
+		// converts the whole numbers to int64 like the objects read from the API server
+		if err := utiljson.Unmarshal(data, &obj); err != nil {
+			L.ArgError(n, "object expected")
+		}
+	}
+	return &unstructured.Unstructured{Object: obj}
+}
+
+// toLua converts the value to a table through its JSON representation
+func toLua(L *lua.LState, value any) lua.LValue {
+	data, err := json.Marshal(value)
+	if err != nil {
+		L.RaiseError("%s", err.Error())
+	}
+	var converted any
+	if err := json.Unmarshal(data, &converted); err != nil {
+		L.RaiseError("%s", err.Error())
+	}
+	return decodeValue(L, converted)
+}
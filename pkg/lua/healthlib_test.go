@@ -0,0 +1,122 @@
+package lua
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const conditionsJSON = `{
+  "apiVersion": "example.com/v1",
+  "kind": "Widget",
+  "metadata": {"name": "test", "generation": 3},
+  "status": {
+    "observedGeneration": 3,
+    "conditions": [
+      {"type": "Ready", "status": "False", "reason": "ProvisioningFailed", "message": "quota exceeded",
+       "lastTransitionTime": "2024-01-01T00:00:00Z"}
+    ]
+  }
+}`
+
+func TestHealthLib(t *testing.T) {
+	obj := StrToUnstructured(conditionsJSON)
+	vm := VM{Now: time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC)}
+
+	for name, test := range map[string]struct {
+		script   string
+		expected health.HealthStatus
+	}{
+		"findCondition": {
+			script: `local health = require("health")
+local ready = health.findCondition(obj, "Ready")
+local missing = health.findCondition(obj, "Synced")
+return {
+  status = "Degraded",
+  message = ready.reason .. ": " .. ready.message .. " " .. tostring(missing),
+}`,
+			expected: health.HealthStatus{
+				Health:  health.HealthUnhealthy,
+				Ready:   true,
+				Message: "ProvisioningFailed: quota exceeded nil",
+			},
+		},
+		"fromStatusName": {
+			script: `return require("health").fromStatusName("CREATE_FAILED", "out of capacity")`,
+			expected: health.HealthStatus{
+				Health:  health.HealthUnhealthy,
+				Ready:   true,
+				Status:  "Create Failed",
+				Message: "out of capacity",
+			},
+		},
+		"time": {
+			script: `local health = require("health")
+local ready = health.findCondition(obj, "Ready")
+local age = health.age(ready.lastTransitionTime)
+local _, err = health.parseTime("yesterday")
+return {
+  status = "Progressing",
+  message = health.parseTime(ready.lastTransitionTime) .. " " .. age .. " " .. tostring(err ~= nil),
+}`,
+			expected: health.HealthStatus{
+				Health:  health.HealthUnknown,
+				Status:  health.HealthStatusProgressing,
+				Message: "1704067200 600 true",
+			},
+		},
+		"humanCase": {
+			script: `
+return {status = "Progressing", message = require("health").humanCase("ProvisioningFailed")}`,
+			expected: health.HealthStatus{
+				Health:  health.HealthUnknown,
+				Status:  health.HealthStatusProgressing,
+				Message: "Provisioning Failed",
+			},
+		},
+		"isGenerationObserved": {
+			script: `local health = require("health")
+local observed = health.isGenerationObserved(obj)
+obj.metadata.generation = 4
+return {
+  status = "Progressing",
+  message = tostring(observed) .. " " .. tostring(health.isGenerationObserved(obj)),
+}`,
+			expected: health.HealthStatus{
+				Health:  health.HealthUnknown,
+				Status:  health.HealthStatusProgressing,
+				Message: "true false",
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			status, err := vm.ExecuteHealthLua(obj, test.script)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, *status)
+		})
+	}
+
+	t.Run("statusMap", func(t *testing.T) {
+		kustomization := StrToUnstructured(`{
+  "apiVersion": "kustomize.toolkit.fluxcd.io/v1",
+  "kind": "Kustomization",
+  "metadata": {"name": "test"},
+  "status": {"conditions": [
+    {"type": "Ready", "status": "True", "reason": "ReconciliationSucceeded", "message": "Applied"}
+  ]}
+}`)
+		expected, err := health.GetResourceHealth(kustomization, nil)
+		require.NoError(t, err)
+		status, err := vm.ExecuteHealthLua(kustomization, `return require("health").statusMap("Kustomization", obj)`)
+		require.NoError(t, err)
+		assert.Equal(t, health.HealthHealthy, status.Health)
+		assert.Equal(t, expected.Status, status.Status)
+		assert.Equal(t, expected.Message, status.Message)
+
+		_, err = vm.ExecuteHealthLua(kustomization, `return require("health").statusMap("NoSuchKind", obj)`)
+		assert.ErrorContains(t, err, "no status map NoSuchKind")
+	})
+}
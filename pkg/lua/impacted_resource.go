@@ -8,43 +8,100 @@ import (
 
 // This struct represents a wrapper, that is returned from Lua custom action script, around the unstructured k8s resource + a k8s operation
 // that will need to be performed on this returned resource.
-// Currently only "create" and "patch" operations are supported for custom actions.
+// The "create", "patch", "replace", "apply" and "delete" operations are supported for custom actions.
+// Patches are only allowed on the source resource of the action, other resources must be created, replaced, applied
+// or deleted.
 // This replaces the traditional architecture of "Lua action returns the source resource for ArgoCD to patch".
 // This enables ArgoCD to create NEW resources upon custom action.
 // Note that the Lua code in the custom action is coupled to this type, since Lua json output is then unmarshalled to this struct.
-// Avoided using iota, since need the mapping of the string value the end users will write in Lua code ("create" and "patch").
+// Avoided using iota, since need the mapping of the string value the end users will write in Lua code ("create", "patch"...).
 // TODO: maybe there is a nicer general way to marshal and unmarshal, instead of explicit iteration over the enum values.
 type K8SOperation string
 
 const (
 	CreateOperation K8SOperation = "create"
 	PatchOperation  K8SOperation = "patch"
+	// ReplaceOperation replaces the whole resource, e.g. to recreate immutable fields with a force replace
+	ReplaceOperation K8SOperation = "replace"
+	// ApplyOperation server-side applies the resource with the FieldManager of the impacted resource
+	ApplyOperation K8SOperation = "apply"
+	// DeleteOperation deletes the resource, only its apiVersion, kind, namespace and name are used
+	DeleteOperation K8SOperation = "delete"
 )
 
+var k8sOperations = []K8SOperation{CreateOperation, PatchOperation, ReplaceOperation, ApplyOperation, DeleteOperation}
+
 type ImpactedResource struct {
 	UnstructuredObj *unstructured.Unstructured `json:"resource"`
 	K8SOperation    K8SOperation               `json:"operation"`
+	// FieldManager is the field manager of an apply operation
+	FieldManager string `json:"fieldManager,omitempty"`
 }
 
 func (op *K8SOperation) UnmarshalJSON(data []byte) error {
-	switch string(data) {
-	case `"create"`:
-		*op = CreateOperation
-	case `"patch"`:
-		*op = PatchOperation
-	default:
-		return fmt.Errorf("unsupported operation: %s", data)
+	for _, operation := range k8sOperations {
+		if string(data) == `"`+string(operation)+`"` {
+			*op = operation
+			return nil
+		}
 	}
-	return nil
+	return fmt.Errorf("unsupported operation: %s", data)
 }
 
 func (op K8SOperation) MarshalJSON() ([]byte, error) {
-	switch op {
-	case CreateOperation:
-		return []byte(`"create"`), nil
+	for _, operation := range k8sOperations {
+		if op == operation {
+			return []byte(`"` + string(op) + `"`), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported operation: %s", op)
+}
+
+// Validate checks that the resource can be used for its operation on the result of an action on source:
+// patches are only allowed on the source resource and only apply operations have a field manager
+func (r ImpactedResource) Validate(source *unstructured.Unstructured) error {
+	if r.UnstructuredObj == nil {
+		return fmt.Errorf("%s operation without a resource", r.K8SOperation)
+	}
+	obj := r.UnstructuredObj
+	if obj.GetAPIVersion() == "" || obj.GetKind() == "" {
+		return fmt.Errorf("%s operation on a resource without an apiVersion or kind", r.K8SOperation)
+	}
+	if obj.GetName() == "" && (r.K8SOperation != CreateOperation || obj.GetGenerateName() == "") {
+		return fmt.Errorf("%s operation on a %s without a name", r.K8SOperation, obj.GetKind())
+	}
+
+	switch r.K8SOperation {
 	case PatchOperation:
-		return []byte(`"patch"`), nil
-	default:
-		return nil, fmt.Errorf("unsupported operation: %s", op)
+		if !r.isSource(source) {
+			return fmt.Errorf("patch operation is only allowed on the source resource %s/%s, not %s/%s",
+				source.GetKind(), source.GetName(), obj.GetKind(), obj.GetName())
+		}
+	case ApplyOperation:
+		if r.FieldManager == "" {
+			return fmt.Errorf("apply operation on %s/%s without a fieldManager", obj.GetKind(), obj.GetName())
+		}
+	}
+	if r.FieldManager != "" && r.K8SOperation != ApplyOperation {
+		return fmt.Errorf("fieldManager is only supported by the apply operation, not %s", r.K8SOperation)
+	}
+	return nil
+}
+
+// isSource returns true if the resource is the source resource of the action
+func (r ImpactedResource) isSource(source *unstructured.Unstructured) bool {
+	return r.UnstructuredObj.GroupVersionKind() == source.GroupVersionKind() &&
+		r.UnstructuredObj.GetName() == source.GetName() &&
+		r.UnstructuredObj.GetNamespace() == source.GetNamespace()
+}
+
+// clean restores the empty structs of the source resource that were converted into empty arrays by lua. Patches,
+// replacements and applies of the source resource are cleaned, created, deleted and other resources are left as is.
+func (r ImpactedResource) clean(source *unstructured.Unstructured) {
+	switch r.K8SOperation {
+	case PatchOperation, ReplaceOperation, ApplyOperation:
+		if r.isSource(source) {
+			r.UnstructuredObj.Object = cleanReturnedObj(r.UnstructuredObj.Object, source.Object)
+		}
 	}
 }
@@ -0,0 +1,198 @@
+package lua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ErrLuaBudgetExceeded is returned when a script exceeds one of the Limits of the VM
+var ErrLuaBudgetExceeded = errors.New("lua budget exceeded")
+
+// Limits bounds the resources used by a script, zero values use the DefaultLimits
+type Limits struct {
+	// Timeout is the maximum duration of a script
+	Timeout time.Duration
+	// CallStackSize is the maximum depth of nested function calls
+	CallStackSize int
+	// RegistrySize is the maximum number of values on the data stack of the script
+	RegistrySize int
+	// MaxInstructions is the maximum number of VM instructions executed by a script, -1 for no limit
+	MaxInstructions int
+	// MaxTableAllocations is the maximum number of tables a script holds in its globals, locals and upvalues or
+	// returns, excluding the tables of obj and the other globals set by the VM, -1 for no limit
+	MaxTableAllocations int
+}
+
+// DefaultLimits are used for the limits not set on a VM
+var DefaultLimits = Limits{
+	Timeout:             1 * time.Second,
+	CallStackSize:       lua.CallStackSize,
+	RegistrySize:        lua.RegistrySize,
+	MaxInstructions:     -1,
+	MaxTableAllocations: -1,
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.Timeout == 0 {
+		l.Timeout = DefaultLimits.Timeout
+	}
+	if l.CallStackSize == 0 {
+		l.CallStackSize = DefaultLimits.CallStackSize
+	}
+	if l.RegistrySize == 0 {
+		l.RegistrySize = DefaultLimits.RegistrySize
+	}
+	if l.MaxInstructions == 0 {
+		l.MaxInstructions = DefaultLimits.MaxInstructions
+	}
+	if l.MaxTableAllocations == 0 {
+		l.MaxTableAllocations = DefaultLimits.MaxTableAllocations
+	}
+	return l
+}
+
+// tableCheckInterval is the number of instructions between two counts of the tables held by a script
+const tableCheckInterval = 1024
+
+var closed = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// budget is the context of a script run. The lua VM checks Done() before every instruction, which is used to
+// count the instructions and periodically the tables held by the script.
+type budget struct {
+	context.Context
+	limits Limits
+
+	l            *lua.LState
+	env          *lua.LTable
+	seen         map[*lua.LTable]bool
+	instructions int
+	exceeded     string
+}
+
+func newBudget(ctx context.Context, limits Limits, l *lua.LState, env *lua.LTable, vars ...lua.LValue) *budget {
+	b := &budget{Context: ctx, limits: limits, l: l, env: env}
+	if limits.MaxTableAllocations >= 0 {
+		// the tables of the vars are allocated by the VM, not the script
+		b.seen = map[*lua.LTable]bool{}
+		for _, v := range vars {
+			countTables(v, b.seen, -1)
+		}
+	}
+	return b
+}
+
+func (b *budget) Done() <-chan struct{} {
+	if b.exceeded == "" {
+		b.instructions++
+		if b.limits.MaxInstructions >= 0 && b.instructions > b.limits.MaxInstructions {
+			b.exceeded = fmt.Sprintf("more than %d instructions", b.limits.MaxInstructions)
+		} else if b.instructions%tableCheckInterval == 0 {
+			b.checkTables()
+		}
+	}
+	if b.exceeded != "" {
+		return closed
+	}
+	return b.Context.Done()
+}
+
+func (b *budget) Err() error {
+	if b.exceeded != "" {
+		return ErrLuaBudgetExceeded
+	}
+	return b.Context.Err()
+}
+
+// checkTables counts the tables reachable from the globals of the script, the locals and upvalues of the running
+// functions and values that are not set by the VM
+func (b *budget) checkTables(values ...lua.LValue) {
+	if b.seen == nil || b.exceeded != "" {
+		return
+	}
+	seen := make(map[*lua.LTable]bool, len(b.seen))
+	for t := range b.seen {
+		seen[t] = true
+	}
+	count := 0
+	// the environment holding the globals is created by the VM
+	seen[b.env] = true
+	b.env.ForEach(func(_, value lua.LValue) {
+		count += countTables(value, seen, b.limits.MaxTableAllocations-count)
+	})
+	values = append(values, b.stackValues()...)
+	for _, v := range values {
+		count += countTables(v, seen, b.limits.MaxTableAllocations-count)
+	}
+	if count > b.limits.MaxTableAllocations {
+		b.exceeded = fmt.Sprintf("more than %d tables", b.limits.MaxTableAllocations)
+	}
+}
+
+// stackValues returns the locals, including the temporaries, and the upvalues of the functions on the call stack
+func (b *budget) stackValues() []lua.LValue {
+	var values []lua.LValue
+	for level := 0; ; level++ {
+		dbg, ok := b.l.GetStack(level)
+		if !ok {
+			return values
+		}
+		for n := 1; ; n++ {
+			name, value := b.l.GetLocal(dbg, n)
+			if name == "" {
+				break
+			}
+			values = append(values, value)
+		}
+		if fn, err := b.l.GetInfo("f", dbg, lua.LNil); err == nil {
+			if fn, ok := fn.(*lua.LFunction); ok && !fn.IsG {
+				for _, upvalue := range fn.Upvalues {
+					values = append(values, upvalue.Value())
+				}
+			}
+		}
+	}
+}
+
+// countTables returns the number of tables reachable from v not already seen, stopping once max is exceeded
+func countTables(v lua.LValue, seen map[*lua.LTable]bool, max int) int {
+	t, ok := v.(*lua.LTable)
+	if !ok || seen[t] {
+		return 0
+	}
+	seen[t] = true
+	count := 1
+	t.ForEach(func(key, value lua.LValue) {
+		if max >= 0 && count > max {
+			return
+		}
+		count += countTables(key, seen, max) + countTables(value, seen, max)
+	})
+	return count
+}
+
+// budgetError wraps the error of a script that exceeded its budget with ErrLuaBudgetExceeded
+func (b *budget) budgetError(err error) error {
+	var reason string
+	switch {
+	case b.exceeded != "":
+		reason = b.exceeded
+	case errors.Is(b.Context.Err(), context.DeadlineExceeded):
+		reason = fmt.Sprintf("timeout of %s", b.limits.Timeout)
+	case strings.Contains(err.Error(), "stack overflow"):
+		reason = fmt.Sprintf("call stack size of %d", b.limits.CallStackSize)
+	case strings.Contains(err.Error(), "registry overflow"):
+		reason = fmt.Sprintf("registry size of %d", b.limits.RegistrySize)
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %s: %w", ErrLuaBudgetExceeded, reason, err)
+}
@@ -0,0 +1,96 @@
+package lua
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimits(t *testing.T) {
+	testObj := StrToUnstructured(objJSON)
+
+	for name, test := range map[string]struct {
+		limits Limits
+		script string
+		reason string
+	}{
+		"timeout": {
+			limits: Limits{Timeout: 10 * time.Millisecond},
+			script: infiniteLoop,
+			reason: "timeout of 10ms",
+		},
+		"instructions": {
+			limits: Limits{MaxInstructions: 1000},
+			script: infiniteLoop,
+			reason: "more than 1000 instructions",
+		},
+		"call stack": {
+			limits: Limits{CallStackSize: 32},
+			script: `local function f(n) return f(n + 1) + 1 end
+return f(0)`,
+			reason: "call stack size of 32",
+		},
+		"tables while running": {
+			limits: Limits{MaxTableAllocations: 100},
+			script: `items = {}
+while true do table.insert(items, {}) end`,
+			reason: "more than 100 tables",
+		},
+		"tables in locals": {
+			limits: Limits{MaxTableAllocations: 100},
+			script: `local items = {}
+while true do items[#items + 1] = {} end`,
+			reason: "more than 100 tables",
+		},
+		"tables in upvalues": {
+			limits: Limits{MaxTableAllocations: 100},
+			script: `local items = {}
+local function add() items[#items + 1] = {} end
+while true do add() end`,
+			reason: "more than 100 tables",
+		},
+		"registry": {
+			limits: Limits{RegistrySize: 256},
+			script: `return unpack({}, 1, 1000)`,
+			reason: "registry size of 256",
+		},
+		"returned tables": {
+			limits: Limits{MaxTableAllocations: 10},
+			script: `local hs = {status = "Healthy", items = {}}
+for i = 1, 20 do hs.items[i] = {} end
+return hs`,
+			reason: "more than 10 tables",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			vm := VM{Limits: test.limits}
+			_, err := vm.ExecuteHealthLua(testObj, test.script)
+			assert.ErrorIs(t, err, ErrLuaBudgetExceeded)
+			assert.ErrorContains(t, err, test.reason)
+		})
+	}
+
+	t.Run("within limits", func(t *testing.T) {
+		// the tables of obj do not count
+		vm := VM{Limits: Limits{MaxInstructions: 100, MaxTableAllocations: 1}}
+		status, err := vm.ExecuteHealthLua(testObj,
+			`return {status = "Healthy", message = obj.metadata.labels["app.kubernetes.io/instance"]}`)
+		require.NoError(t, err)
+		assert.Equal(t, "helm-guestbook", status.Message)
+	})
+
+	t.Run("health status", func(t *testing.T) {
+		overrides := ResourceHealthOverrides{"argoproj.io/Rollout": ResourceOverride{HealthLua: infiniteLoop}}
+		defaultLimits := DefaultLimits
+		DefaultLimits.MaxInstructions = 1000
+		defer func() { DefaultLimits = defaultLimits }()
+
+		status, err := health.GetResourceHealth(testObj, overrides)
+		require.NoError(t, err)
+		assert.Equal(t, health.HealthStatusBudgetExceeded, status.Status)
+		assert.Equal(t, health.HealthUnknown, status.Health)
+	})
+}
@@ -0,0 +1,111 @@
+package lua
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LintIssue is a problem found in a directory of resource customizations
+type LintIssue struct {
+	// Path is relative to the linted directory
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Path, i.Message)
+}
+
+// LintCustomizations checks a directory laid out like the embedded resource customizations for scripts that are
+// never loaded because of their name or a syntax error, tests without the script they test and tests referencing
+// missing files
+func LintCustomizations(dir string) ([]LintIssue, error) {
+	var issues []LintIssue
+	report := func(p, format string, args ...any) {
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			rel = p
+		}
+		issues = append(issues, LintIssue{Path: filepath.ToSlash(rel), Message: fmt.Sprintf(format, args...)})
+	}
+	exists := func(p string) bool {
+		_, err := os.Stat(p)
+		return err == nil
+	}
+
+	err := walkCustomizations(dir, func(p string) error {
+		parent := filepath.Base(filepath.Dir(p))
+		switch name := filepath.Base(p); {
+		case filepath.Ext(name) == ".lua":
+			if expected := expectedScriptName(filepath.ToSlash(p)); expected != name {
+				report(p, "script is never loaded, expected %s", expected)
+			}
+			script, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			if _, err := compile(string(script)); err != nil {
+				report(p, "%s", strings.TrimSpace(err.Error()))
+			}
+
+		case name == healthTestFile:
+			if !exists(filepath.Join(filepath.Dir(p), healthScriptFile)) {
+				report(p, "tests without a %s", healthScriptFile)
+			}
+			var tests TestStructure
+			if err := readTestFile(p, &tests); err != nil {
+				report(p, "%s", err.Error())
+			}
+			for _, test := range tests.Tests {
+				if !exists(filepath.Join(filepath.Dir(p), test.InputPath)) {
+					report(p, "missing inputPath %s", test.InputPath)
+				}
+			}
+
+		case name == actionTestFile:
+			if parent != "actions" {
+				report(p, "action tests outside of an actions directory")
+			}
+			var tests ActionTestStructure
+			if err := readTestFile(p, &tests); err != nil {
+				report(p, "%s", err.Error())
+			}
+			if len(tests.DiscoveryTests) > 0 && !exists(filepath.Join(filepath.Dir(p), actionDiscoveryScriptFile)) {
+				report(p, "discovery tests without a %s", actionDiscoveryScriptFile)
+			}
+			for _, test := range tests.DiscoveryTests {
+				if !exists(filepath.Join(filepath.Dir(p), test.InputPath)) {
+					report(p, "missing inputPath %s", test.InputPath)
+				}
+			}
+			for _, test := range tests.ActionTests {
+				if !exists(filepath.Join(filepath.Dir(p), test.Action, actionScriptFile)) {
+					report(p, "tests of action %s without a %s/%s", test.Action, test.Action, actionScriptFile)
+				}
+				for _, file := range []string{test.InputPath, test.ExpectedOutputPath} {
+					if !exists(filepath.Join(filepath.Dir(p), file)) {
+						report(p, "missing file %s", file)
+					}
+				}
+			}
+		}
+		return nil
+	})
+	return issues, err
+}
+
+// expectedScriptName returns the name a lua script must have to be loaded from its directory: the discovery.lua of
+// an actions directory, the action.lua of an action directory or the health.lua of a kind
+func expectedScriptName(p string) string {
+	dir := path.Dir(p)
+	switch {
+	case path.Base(dir) == "actions":
+		return actionDiscoveryScriptFile
+	case path.Base(path.Dir(dir)) == "actions":
+		return actionScriptFile
+	}
+	return healthScriptFile
+}
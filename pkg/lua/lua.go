@@ -2,12 +2,12 @@ package lua
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
-	"os"
-	"path/filepath"
+	"path"
+	"slices"
 	"strings"
 	"time"
 
@@ -37,9 +37,18 @@ func init() {
 
 func (overrides ResourceHealthOverrides) GetResourceHealth(
 	obj *unstructured.Unstructured,
+) (*health.HealthStatus, error) {
+	return overrides.GetResourceHealthAt(obj, time.Time{})
+}
+
+// GetResourceHealthAt evaluates the health script with os.time() and os.date() returning now
+func (overrides ResourceHealthOverrides) GetResourceHealthAt(
+	obj *unstructured.Unstructured,
+	now time.Time,
 ) (*health.HealthStatus, error) {
 	luaVM := VM{
 		ResourceOverrides: overrides,
+		Now:               now,
 	}
 	script, useOpenLibs, err := luaVM.GetHealthScript(obj)
 	if err != nil {
@@ -51,62 +60,78 @@ func (overrides ResourceHealthOverrides) GetResourceHealth(
 	// enable/disable the usage of lua standard library
 	luaVM.UseOpenLibs = useOpenLibs
 	result, err := luaVM.ExecuteHealthLua(obj, script)
+	if errors.Is(err, ErrLuaBudgetExceeded) {
+		return &health.HealthStatus{
+			Health:  health.HealthUnknown,
+			Status:  health.HealthStatusBudgetExceeded,
+			Message: err.Error(),
+		}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
+// HealthSource returns the override key or the path of the health script evaluated for the resource, or an empty
+// string if there is none
+func (overrides ResourceHealthOverrides) HealthSource(obj *unstructured.Unstructured) string {
+	_, source, _, _ := VM{ResourceOverrides: overrides}.getHealthScript(obj)
+	return source
+}
+
 // VM Defines a struct that implements the luaVM
 type VM struct {
 	ResourceOverrides map[string]ResourceOverride
 	// UseOpenLibs flag to enable open libraries. Libraries are disabled by default while running, but enabled during testing to allow the use of print statements
 	UseOpenLibs bool
+	// Now is returned by os.time() and os.date(), defaults to the current time
+	Now time.Time
+	// Limits bounds the resources used by the scripts, unset limits use the DefaultLimits
+	Limits Limits
 }
 
-func (vm VM) runLua(obj *unstructured.Unstructured, script string) (*lua.LState, error) {
-	l := lua.NewState(lua.Options{
-		SkipOpenLibs: !vm.UseOpenLibs,
-	})
-	defer l.Close()
-	// Opens table library to allow access to functions to manipulate tables
-	for _, pair := range []struct {
-		n string
-		f lua.LGFunction
-	}{
-		{lua.LoadLibName, lua.OpenPackage},
-		{lua.BaseLibName, lua.OpenBase},
-		{lua.TabLibName, lua.OpenTable},
-		// load our 'safe' version of the OS library
-		{lua.OsLibName, OpenSafeOs},
-	} {
-		if err := l.CallByParam(lua.P{
-			Fn:      l.NewFunction(pair.f),
-			NRet:    0,
-			Protect: true,
-		}, lua.LString(pair.n)); err != nil {
-			panic(err)
-		}
+func (vm VM) now() time.Time {
+	if vm.Now.IsZero() {
+		return time.Now()
 	}
-	// preload our 'safe' version of the OS library. Allows the 'local os = require("os")' to work
-	l.PreloadModule(lua.OsLibName, SafeOsLoader)
+	return vm.Now
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
-	l.SetContext(ctx)
-	objectValue := decodeValue(l, obj.Object)
-	l.SetGlobal("obj", objectValue)
-	err := l.DoString(script)
-	return l, err
+// runLua runs the script on a pooled sandbox with obj and the globals set, returning the last value returned by
+// the script
+func (vm VM) runLua(obj *unstructured.Unstructured, script string, globals map[string]any) (lua.LValue, error) {
+	proto, err := compileLua(script)
+	if err != nil {
+		return nil, err
+	}
+	limits := vm.Limits.withDefaults()
+	opts := sandboxOptions{
+		useOpenLibs:   vm.UseOpenLibs,
+		callStackSize: limits.CallStackSize,
+		registrySize:  limits.RegistrySize,
+	}
+	s := getSandbox(opts)
+	vars := map[string]any{"obj": obj.Object}
+	for name, value := range globals {
+		vars[name] = value
+	}
+	returnValue, err := s.run(vars, proto, vm.now, limits)
+	if err != nil {
+		// the state may be left in an inconsistent state, e.g. after a timeout
+		s.l.Close()
+		return nil, err
+	}
+	putSandbox(opts, s)
+	return returnValue, nil
 }
 
 // ExecuteHealthLua runs the lua script to generate the health status of a resource
 func (vm VM) ExecuteHealthLua(obj *unstructured.Unstructured, script string) (*health.HealthStatus, error) {
-	l, err := vm.runLua(obj, script)
+	returnValue, err := vm.runLua(obj, script, nil)
 	if err != nil {
 		return nil, err
 	}
-	returnValue := l.Get(-1)
 	if returnValue.Type() == lua.LTTable {
 
 		jsonBytes, err := luajson.Encode(returnValue)
@@ -119,65 +144,93 @@ func (vm VM) ExecuteHealthLua(obj *unstructured.Unstructured, script string) (*h
 			return nil, err
 		}
 
-		if healthStatus.Status != "" && healthStatus.Health == "" {
-			switch healthStatus.Status {
-			case health.HealthStatusUnknown:
-				healthStatus.Health = health.HealthUnknown
-				healthStatus.Status = ""
-			case health.HealthStatusProgressing:
-				healthStatus.Health = health.HealthUnknown
-			case health.HealthStatusSuspended:
-				healthStatus.Health = health.HealthUnknown
-			case health.HealthStatusHealthy:
-				healthStatus.Status = ""
-				healthStatus.Health = health.HealthHealthy
-				healthStatus.Ready = true
-			case health.HealthStatusDegraded:
-				healthStatus.Status = ""
-				healthStatus.Health = health.HealthUnhealthy
-				healthStatus.Ready = true
-			case health.HealthStatusMissing:
-				healthStatus.Ready = true
-			}
-		}
-		healthStatus.Health = health.Health(strings.ToLower(string(healthStatus.Health)))
-
+		normalizeHealthStatus(healthStatus)
 		return healthStatus, nil
 	}
 	return nil, fmt.Errorf(incorrectReturnType, "table", returnValue.Type().String())
 }
 
+// normalizeHealthStatus maps the Argo CD status returned by the scripts, e.g. {status = "Degraded"}, to the health
+// and readiness of is-healthy
+func normalizeHealthStatus(healthStatus *health.HealthStatus) {
+	if healthStatus.Status != "" && healthStatus.Health == "" {
+		switch healthStatus.Status {
+		case health.HealthStatusUnknown:
+			healthStatus.Health = health.HealthUnknown
+			healthStatus.Status = ""
+		case health.HealthStatusProgressing:
+			healthStatus.Health = health.HealthUnknown
+		case health.HealthStatusSuspended:
+			healthStatus.Health = health.HealthUnknown
+		case health.HealthStatusHealthy:
+			healthStatus.Status = ""
+			healthStatus.Health = health.HealthHealthy
+			healthStatus.Ready = true
+		case health.HealthStatusDegraded:
+			healthStatus.Status = ""
+			healthStatus.Health = health.HealthUnhealthy
+			healthStatus.Ready = true
+		case health.HealthStatusMissing:
+			healthStatus.Ready = true
+		}
+	}
+	healthStatus.Health = health.Health(strings.ToLower(string(healthStatus.Health)))
+}
+
 // GetHealthScript attempts to read lua script from config and then filesystem for that resource
 func (vm VM) GetHealthScript(obj *unstructured.Unstructured) (string, bool, error) {
+	script, _, useOpenLibs, err := vm.getHealthScript(obj)
+	return script, useOpenLibs, err
+}
+
+// getHealthScript returns the health script of the resource and its source, i.e. the override key or the path of
+// the script file
+func (vm VM) getHealthScript(obj *unstructured.Unstructured) (script, source string, useOpenLibs bool, err error) {
 	// first, search the gvk as is in the ResourceOverrides
 	key := GetConfigMapKey(obj.GroupVersionKind())
 
 	if script, ok := vm.ResourceOverrides[key]; ok && script.HealthLua != "" {
-		return script.HealthLua, script.UseOpenLibs, nil
+		return script.HealthLua, overrideSource(key), script.UseOpenLibs, nil
 	}
 
 	// if not found as is, perhaps it matches wildcard entries in the configmap
-	wildcardKey := GetWildcardConfigMapKey(vm, obj.GroupVersionKind())
-
-	if wildcardKey != "" {
-		if wildcardScript, ok := vm.ResourceOverrides[wildcardKey]; ok && wildcardScript.HealthLua != "" {
-			return wildcardScript.HealthLua, wildcardScript.UseOpenLibs, nil
+	// (skipping the wildcards without a health script, e.g. the */* of resource.customizations.ignoreDifferences.all)
+	for _, wildcardKey := range getWildcardConfigMapKeys(vm, obj.GroupVersionKind()) {
+		if wildcardScript := vm.ResourceOverrides[wildcardKey]; wildcardScript.HealthLua != "" {
+			return wildcardScript.HealthLua, overrideSource(wildcardKey), wildcardScript.UseOpenLibs, nil
 		}
 	}
 
-	// if not found in the ResourceOverrides at all, search it as is in the built-in scripts
-	// (as built-in scripts are files in folders, named after the GVK, currently there is no wildcard support for them)
-	builtInScript, err := vm.getPredefinedLuaScripts(key, healthScriptFile)
+	// if not found in the ResourceOverrides at all, search it in the customization directories and the built-in
+	// scripts (wildcards are only supported by the customization directories)
+	builtInScript, source, err := vm.getPredefinedLuaScripts(key, healthScriptFile)
 	// standard libraries will be enabled for all built-in scripts
-	return builtInScript, true, err
+	return builtInScript, source, true, err
+}
+
+func overrideSource(key string) string {
+	return "override:" + key
 }
 
-func (vm VM) ExecuteResourceAction(obj *unstructured.Unstructured, script string) ([]ImpactedResource, error) {
-	l, err := vm.runLua(obj, script)
+// ExecuteResourceAction runs the action script, the params are available to the script in the actionParams table
+// with values converted to their type
+func (vm VM) ExecuteResourceAction(
+	obj *unstructured.Unstructured,
+	script string,
+	params ...ResourceActionParam,
+) ([]ImpactedResource, error) {
+	actionParams := make(map[string]any, len(params))
+	for _, param := range params {
+		value, err := param.TypedValue()
+		if err != nil {
+			return nil, err
+		}
+		actionParams[param.Name] = value
+	}
+	returnValue, err := vm.runLua(obj, script, map[string]any{"actionParams": actionParams})
 	if err != nil {
 		return nil, err
 	}
-	returnValue := l.Get(-1)
 	if returnValue.Type() == lua.LTTable {
 		jsonBytes, err := luajson.Encode(returnValue)
 		if err != nil {
@@ -207,17 +260,15 @@ func (vm VM) ExecuteResourceAction(obj *unstructured.Unstructured, script string
 			}
 			// Wrap the old-style action output with a single-member array.
 			// The default definition of the old-style action is a "patch" one.
-			impactedResources = append(impactedResources, ImpactedResource{newObj, PatchOperation})
+			impactedResources = append(impactedResources,
+				ImpactedResource{UnstructuredObj: newObj, K8SOperation: PatchOperation})
 		}
 
 		for _, impactedResource := range impactedResources {
-			// Cleaning the resource is only relevant to "patch"
-			if impactedResource.K8SOperation == PatchOperation {
-				impactedResource.UnstructuredObj.Object = cleanReturnedObj(
-					impactedResource.UnstructuredObj.Object,
-					obj.Object,
-				)
+			if err := impactedResource.Validate(obj); err != nil {
+				return nil, err
 			}
+			impactedResource.clean(obj)
 		}
 		return impactedResources, nil
 	}
@@ -294,11 +345,10 @@ func cleanReturnedArray(newObj, obj []interface{}) []interface{} {
 }
 
 func (vm VM) ExecuteResourceActionDiscovery(obj *unstructured.Unstructured, script string) ([]ResourceAction, error) {
-	l, err := vm.runLua(obj, script)
+	returnValue, err := vm.runLua(obj, script, nil)
 	if err != nil {
 		return nil, err
 	}
-	returnValue := l.Get(-1)
 	if returnValue.Type() == lua.LTTable {
 
 		jsonBytes, err := luajson.Encode(returnValue)
@@ -376,7 +426,7 @@ func (vm VM) GetResourceActionDiscovery(obj *unstructured.Unstructured) (string,
 		return actions.ActionDiscoveryLua, nil
 	}
 	discoveryKey := fmt.Sprintf("%s/actions/", key)
-	discoveryScript, err := vm.getPredefinedLuaScripts(discoveryKey, actionDiscoveryScriptFile)
+	discoveryScript, _, err := vm.getPredefinedLuaScripts(discoveryKey, actionDiscoveryScriptFile)
 	if err != nil {
 		return "", err
 	}
@@ -400,7 +450,7 @@ func (vm VM) GetResourceAction(obj *unstructured.Unstructured, actionName string
 	}
 
 	actionKey := fmt.Sprintf("%s/actions/%s", key, actionName)
-	actionScript, err := vm.getPredefinedLuaScripts(actionKey, actionScriptFile)
+	actionScript, _, err := vm.getPredefinedLuaScripts(actionKey, actionScriptFile)
 	if err != nil {
 		return ResourceActionDefinition{}, err
 	}
@@ -419,25 +469,45 @@ func GetConfigMapKey(gvk schema.GroupVersionKind) string {
 }
 
 func GetWildcardConfigMapKey(vm VM, gvk schema.GroupVersionKind) string {
+	if keys := getWildcardConfigMapKeys(vm, gvk); len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// getWildcardConfigMapKeys returns the sorted override keys matching the gvk
+func getWildcardConfigMapKeys(vm VM, gvk schema.GroupVersionKind) []string {
 	gvkKeyToMatch := GetConfigMapKey(gvk)
 
+	var keys []string
 	for key := range vm.ResourceOverrides {
 		if Match(key, gvkKeyToMatch) {
-			return key
+			keys = append(keys, key)
 		}
 	}
-	return ""
+	slices.Sort(keys)
+	return keys
 }
 
 func ListResourceTypes() []string {
 	types := []string{}
 
+	customizationDirsLock.RLock()
+	for _, dir := range customizationDirs {
+		for _, t := range dir.resourceTypes() {
+			if !slices.Contains(types, t) && strings.Contains(t, "/") {
+				types = append(types, t)
+			}
+		}
+	}
+	customizationDirsLock.RUnlock()
+
 	_ = fs.WalkDir(resource_customizations.Embedded, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 		if d.IsDir() && !strings.HasSuffix(d.Name(), "testdata") && !strings.Contains(path, "/actions") &&
-			strings.Contains(path, "/") {
+			strings.Contains(path, "/") && !slices.Contains(types, path) {
 			types = append(types, path)
 		}
 		return nil
@@ -446,15 +516,12 @@ func ListResourceTypes() []string {
 	return types
 }
 
-func (vm VM) getPredefinedLuaScripts(objKey string, scriptFile string) (string, error) {
-	data, err := resource_customizations.Embedded.ReadFile(filepath.Join(objKey, scriptFile))
+func (vm VM) getPredefinedLuaScripts(objKey string, scriptFile string) (string, string, error) {
+	data, source, err := readCustomization(path.Join(objKey, scriptFile))
 	if err != nil {
-		if os.IsNotExist(err) {
-			return "", nil
-		}
-		return "", err
+		return "", "", err
 	}
-	return string(data), nil
+	return string(data), source, nil
 }
 
 // Took logic from the link below and added the int, int32, and int64 types since the value would have type int64
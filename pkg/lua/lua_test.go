@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/flanksource/is-healthy/pkg/health"
 	"github.com/stretchr/testify/assert"
@@ -119,6 +120,25 @@ func TestFailExternalLibCall(t *testing.T) {
 	assert.IsType(t, &lua.ApiError{}, err)
 }
 
+const osTimeScript = `local os = require("os")
+hs = {}
+hs.status = "Healthy"
+hs.message = os.date("!%Y-%m-%d %H:%M", os.time())
+return hs`
+
+func TestExecuteHealthLuaWithNow(t *testing.T) {
+	testObj := StrToUnstructured(objJSON)
+	vm := VM{Now: time.Date(2024, 7, 1, 12, 30, 0, 0, time.UTC)}
+	status, err := vm.ExecuteHealthLua(testObj, osTimeScript)
+	assert.Nil(t, err)
+	assert.Equal(t, "2024-07-01 12:30", status.Message)
+
+	overrides := ResourceHealthOverrides{"argoproj.io/Rollout": ResourceOverride{HealthLua: osTimeScript}}
+	status, err = health.GetResourceHealthWithOptions(testObj, health.Options{Override: overrides, Now: vm.Now})
+	assert.Nil(t, err)
+	assert.Equal(t, "2024-07-01 12:30", status.Message)
+}
+
 const returnInt = `return 1`
 
 func TestFailLuaReturnNonTable(t *testing.T) {
@@ -134,7 +154,9 @@ func TestHandleInfiniteLoop(t *testing.T) {
 	testObj := StrToUnstructured(objJSON)
 	vm := VM{}
 	_, err := vm.ExecuteHealthLua(testObj, infiniteLoop)
-	assert.IsType(t, &lua.ApiError{}, err)
+	assert.ErrorIs(t, err, ErrLuaBudgetExceeded)
+	var apiErr *lua.ApiError
+	assert.ErrorAs(t, err, &apiErr)
 }
 
 func TestGetHealthScriptWithOverride(t *testing.T) {
@@ -153,6 +175,28 @@ func TestGetHealthScriptWithOverride(t *testing.T) {
 	assert.Equal(t, newHealthStatusFunction, script)
 }
 
+func TestHealthTraceSource(t *testing.T) {
+	testObj := StrToUnstructured(objJSON)
+	for name, overrides := range map[string]ResourceHealthOverrides{
+		"embedded:argoproj.io/Rollout/health.lua": {},
+		"override:argoproj.io/*":                  {"argoproj.io/*": {HealthLua: newHealthStatusFunction}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			hs, err := health.GetResourceHealthWithOptions(testObj, health.Options{Override: overrides, Trace: true})
+			assert.NoError(t, err)
+			var messages []string
+			for _, step := range hs.Trace {
+				if step.Source == health.TraceSourceOverride {
+					messages = append(messages, step.Message)
+				}
+			}
+			if assert.Len(t, messages, 1) {
+				assert.Contains(t, messages[0], name+" returned")
+			}
+		})
+	}
+}
+
 func TestGetHealthScriptWithKindWildcardOverride(t *testing.T) {
 	testObj := StrToUnstructured(objJSON)
 	vm := VM{
@@ -590,6 +634,156 @@ func TestExecuteNewStyleActionMixedOperationsFailure(t *testing.T) {
 	assert.Contains(t, err.Error(), "unsupported operation")
 }
 
+const recreateJobActionLua = `
+job = {}
+job.apiVersion = "batch/v1"
+job.kind = "Job"
+job.metadata = {}
+job.metadata.name = "hello-1"
+job.metadata.namespace = obj.metadata.namespace
+
+recreated = {}
+recreated.apiVersion = "batch/v1"
+recreated.kind = "Job"
+recreated.metadata = {}
+recreated.metadata.generateName = "hello-"
+recreated.metadata.namespace = obj.metadata.namespace
+
+obj.spec = {}
+obj.spec.suspend = true
+
+policy = {}
+policy.apiVersion = "policy/v1"
+policy.kind = "PodDisruptionBudget"
+policy.metadata = {}
+policy.metadata.name = "hello"
+policy.metadata.namespace = obj.metadata.namespace
+
+return {
+  {operation = "delete", resource = job},
+  {operation = "create", resource = recreated},
+  {operation = "replace", resource = obj},
+  {operation = "apply", resource = policy, fieldManager = "is-healthy"},
+}
+`
+
+const expectedRecreateJobObjList = `
+- operation: delete
+  resource:
+    apiVersion: batch/v1
+    kind: Job
+    metadata:
+      name: hello-1
+      namespace: test-ns
+- operation: create
+  resource:
+    apiVersion: batch/v1
+    kind: Job
+    metadata:
+      generateName: hello-
+      namespace: test-ns
+- operation: replace
+  resource:
+    apiVersion: batch/v1
+    kind: CronJob
+    metadata:
+      name: hello
+      namespace: test-ns
+    spec:
+      suspend: true
+- operation: apply
+  fieldManager: is-healthy
+  resource:
+    apiVersion: policy/v1
+    kind: PodDisruptionBudget
+    metadata:
+      name: hello
+      namespace: test-ns
+`
+
+func TestExecuteNewStyleActionDeleteReplaceApply(t *testing.T) {
+	testObj := StrToUnstructured(cronJobObjYaml)
+	jsonBytes, err := yaml.YAMLToJSON([]byte(expectedRecreateJobObjList))
+	assert.Nil(t, err)
+	expectedObjects, err := UnmarshalToImpactedResources(string(jsonBytes))
+	assert.Nil(t, err)
+	vm := VM{}
+	newObjects, err := vm.ExecuteResourceAction(testObj, recreateJobActionLua)
+	assert.Nil(t, err)
+	assert.Equal(t, expectedObjects, newObjects)
+
+	// the output of the action can be marshaled back
+	data, err := json.Marshal(newObjects)
+	assert.Nil(t, err)
+	assert.JSONEq(t, string(jsonBytes), string(data))
+}
+
+func TestCleanReplace(t *testing.T) {
+	testObj := StrToUnstructured(objWithEmptyStruct)
+	expectedObj := StrToUnstructured(expectedUpdatedObjWithEmptyStruct)
+	vm := VM{}
+	for _, operation := range []string{`operation = "replace"`, `operation = "apply", fieldManager = "test"`} {
+		newObjects, err := vm.ExecuteResourceAction(testObj.DeepCopy(), `
+obj.spec.paused = false
+return {{`+operation+`, resource = obj}}`)
+		assert.Nil(t, err)
+		assert.Len(t, newObjects, 1)
+		assert.Equal(t, expectedObj, newObjects[0].UnstructuredObj)
+	}
+}
+
+func TestExecuteNewStyleActionInvalidOperations(t *testing.T) {
+	testObj := StrToUnstructured(cronJobObjYaml)
+	vm := VM{}
+	for _, test := range []struct {
+		script      string
+		expectedErr string
+	}{
+		{
+			script:      `return {{operation = "apply", resource = obj}}`,
+			expectedErr: "apply operation on CronJob/hello without a fieldManager",
+		},
+		{
+			script:      `return {{operation = "replace", resource = obj, fieldManager = "test"}}`,
+			expectedErr: "fieldManager is only supported by the apply operation, not replace",
+		},
+		{
+			script: `return {{operation = "delete", resource = {
+  apiVersion = "batch/v1", kind = "Job", metadata = {namespace = "test-ns"}}}}`,
+			expectedErr: "delete operation on a Job without a name",
+		},
+		{
+			script:      `return {{operation = "delete", resource = {kind = "Job", metadata = {name = "hello-1"}}}}`,
+			expectedErr: "delete operation on a resource without an apiVersion or kind",
+		},
+		{
+			script:      `return {{operation = "delete"}}`,
+			expectedErr: "delete operation without a resource",
+		},
+	} {
+		_, err := vm.ExecuteResourceAction(testObj, test.script)
+		assert.EqualError(t, err, test.expectedErr, test.script)
+	}
+}
+
+func TestExecuteNewStyleActionPatchOtherResource(t *testing.T) {
+	testObj := StrToUnstructured(cronJobObjYaml)
+	vm := VM{}
+	_, err := vm.ExecuteResourceAction(testObj, `
+return {{operation = "patch", resource = {apiVersion = "batch/v1", kind = "Job", metadata = {name = "hello-1"}}}}`)
+	assert.EqualError(t, err, "patch operation is only allowed on the source resource CronJob/hello, not Job/hello-1")
+
+	// the source resource is matched by its apiVersion, kind, namespace and name
+	_, err = vm.ExecuteResourceAction(testObj, `
+obj.metadata.namespace = "other"
+return {{operation = "patch", resource = obj}}`)
+	assert.EqualError(t, err, "patch operation is only allowed on the source resource CronJob/hello, not CronJob/hello")
+
+	impacted, err := vm.ExecuteResourceAction(testObj, `return {{operation = "patch", resource = obj}}`)
+	assert.NoError(t, err)
+	assert.Len(t, impacted, 1)
+}
+
 func TestExecuteResourceActionNonTableReturn(t *testing.T) {
 	testObj := StrToUnstructured(objJSON)
 	vm := VM{}
@@ -749,3 +943,78 @@ return hs`
 		assert.Nil(t, status)
 	})
 }
+
+func TestExecuteResourceActionWithParams(t *testing.T) {
+	vm := VM{}
+	obj := getObj("../resource_customizations/argoproj.io/Rollout/actions/testdata/one_replica_rollout.yaml")
+	action, err := vm.GetResourceAction(obj, "scale")
+	assert.NoError(t, err)
+	scale := ResourceAction{Name: "scale", Params: []ResourceActionParam{{Name: "replicas", Type: "integer"}}}
+
+	params, err := scale.ResolveParams(map[string]string{"replicas": "3"})
+	assert.NoError(t, err)
+	impactedResources, err := vm.ExecuteResourceAction(obj, action.ActionLua, params...)
+	assert.NoError(t, err)
+	if assert.Len(t, impactedResources, 1) {
+		replicas, _, _ := unstructured.NestedFieldNoCopy(impactedResources[0].UnstructuredObj.Object,
+			"spec", "replicas")
+		assert.EqualValues(t, 3, replicas)
+	}
+
+	_, err = vm.ExecuteResourceAction(obj, action.ActionLua,
+		ResourceActionParam{Name: "replicas", Value: "-1", Type: "integer"})
+	assert.ErrorContains(t, err, "replicas must be a non-negative integer")
+
+	_, err = scale.ResolveParams(map[string]string{"replicas": "three"})
+	assert.ErrorContains(t, err, `parameter replicas expects a value of type integer, not "three"`)
+	_, err = scale.ResolveParams(map[string]string{"count": "3"})
+	assert.ErrorContains(t, err, "action scale has no parameter count")
+	_, err = scale.ResolveParams(nil)
+	assert.ErrorContains(t, err, "action scale requires the parameter replicas")
+
+	params, err = ResourceAction{Params: []ResourceActionParam{
+		{Name: "image", Default: "nginx:1.25"},
+		{Name: "force", Type: "boolean", Default: "false"},
+	}}.ResolveParams(map[string]string{"force": "true"})
+	assert.NoError(t, err)
+	impactedResources, err = vm.ExecuteResourceAction(obj, `
+obj.metadata.annotations = {image = actionParams.image, force = tostring(actionParams.force)}
+return obj`, params...)
+	assert.NoError(t, err)
+	if assert.Len(t, impactedResources, 1) {
+		assert.Equal(t, map[string]string{"image": "nginx:1.25", "force": "true"},
+			impactedResources[0].UnstructuredObj.GetAnnotations())
+	}
+}
+
+func TestCreateWorkflowWithArguments(t *testing.T) {
+	vm := VM{}
+	obj := getObj("../resource_customizations/argoproj.io/WorkflowTemplate/actions/testdata/workflowtemplate.yaml")
+	discoveryLua, err := vm.GetResourceActionDiscovery(obj)
+	assert.NoError(t, err)
+	actions, err := vm.ExecuteResourceActionDiscovery(obj, discoveryLua)
+	assert.NoError(t, err)
+	if !assert.Len(t, actions, 1) {
+		return
+	}
+	action, err := vm.GetResourceAction(obj, actions[0].Name)
+	assert.NoError(t, err)
+
+	params, err := actions[0].ResolveParams(map[string]string{"message": "hello parameters"})
+	assert.NoError(t, err)
+	impactedResources, err := vm.ExecuteResourceAction(obj, action.ActionLua, params...)
+	assert.NoError(t, err)
+	if assert.Len(t, impactedResources, 1) {
+		parameters, _, _ := unstructured.NestedSlice(impactedResources[0].UnstructuredObj.Object,
+			"spec", "arguments", "parameters")
+		assert.Equal(t, []any{map[string]any{"name": "message", "value": "hello parameters"}}, parameters)
+	}
+
+	// without parameters the workflow uses the arguments of the template
+	impactedResources, err = vm.ExecuteResourceAction(obj, action.ActionLua)
+	assert.NoError(t, err)
+	if assert.Len(t, impactedResources, 1) {
+		_, found, _ := unstructured.NestedFieldNoCopy(impactedResources[0].UnstructuredObj.Object, "spec", "arguments")
+		assert.False(t, found)
+	}
+}
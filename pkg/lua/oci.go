@@ -0,0 +1,289 @@
+package lua
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// OCIScheme prefixes the references of OCI artifacts, e.g. oci://ghcr.io/org/customizations:v1
+const OCIScheme = "oci://"
+
+const (
+	ociManifestMediaType    = "application/vnd.oci.image.manifest.v1+json"
+	dockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	ociTitleAnnotation      = "org.opencontainers.image.title"
+	// orasUnpackAnnotation marks the layers of the directories pushed by oras
+	orasUnpackAnnotation = "io.deis.oras.content.unpack"
+	maxOCIManifestSize   = 4 << 20
+	// maxOCILayerSize bounds the layers and the files extracted from them
+	maxOCILayerSize = 64 << 20
+)
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// ociHTTPClient is replaced by the tests to trust their TLS server
+var ociHTTPClient = http.DefaultClient
+
+// LoadCustomizationsOCI pulls an OCI artifact of resource customizations, e.g. pushed with
+// `oras push ghcr.io/org/customizations:v1 customizations/`, and layers it over the embedded customizations like
+// LoadCustomizationsDir. The artifact is read once, its scripts are named after the reference and it cannot be
+// reloaded or watched.
+func LoadCustomizationsOCI(ctx context.Context, ref string) (*CustomizationsDir, error) {
+	dir, err := os.MkdirTemp("", "is-healthy-customizations-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := PullOCIArtifact(ctx, ref, dir); err != nil {
+		return nil, err
+	}
+	d := &CustomizationsDir{Path: dir}
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+	d.Path = strings.TrimSuffix(ref, "/")
+	load(d)
+	return d, nil
+}
+
+// PullOCIArtifact writes the layers of the OCI artifact at oci://<registry>/<repository>[:<tag>|@<digest>] into
+// dir. Tar layers are extracted, without the leading directory named by their title annotation as oras adds it to
+// pushed directories, and the other layers are written to the path of their title annotation. Public registries
+// are pulled with an anonymous token.
+func PullOCIArtifact(ctx context.Context, ref, dir string) error {
+	registry, repository, reference, err := parseOCIReference(ref)
+	if err != nil {
+		return err
+	}
+	c := &ociClient{base: "https://" + registry + "/v2/" + repository}
+
+	var manifest struct {
+		Layers []struct {
+			MediaType   string            `json:"mediaType"`
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"layers"`
+	}
+	data, err := c.get(ctx, "/manifests/"+reference, maxOCIManifestSize,
+		ociManifestMediaType, dockerManifestMediaType)
+	if err != nil {
+		return fmt.Errorf("failed to pull the manifest of %s: %w", ref, err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("invalid manifest of %s: %w", ref, err)
+	}
+	if len(manifest.Layers) == 0 {
+		return fmt.Errorf("%s has no layers, is it an image index?", ref)
+	}
+
+	for _, layer := range manifest.Layers {
+		blob, err := c.get(ctx, "/blobs/"+layer.Digest, maxOCILayerSize)
+		if err != nil {
+			return fmt.Errorf("failed to pull layer %s of %s: %w", layer.Digest, ref, err)
+		}
+		if err := verifyOCIDigest(layer.Digest, blob); err != nil {
+			return fmt.Errorf("layer of %s: %w", ref, err)
+		}
+
+		if err := writeOCILayer(dir, layer.MediaType, layer.Annotations, blob); err != nil {
+			return fmt.Errorf("layer %s of %s: %w", layer.Digest, ref, err)
+		}
+	}
+	return nil
+}
+
+// writeOCILayer writes a file layer to the path of its title, or extracts a directory layer into dir. oras pushes
+// files with a tar media type too, only the layers without a title or marked to be unpacked are archives.
+func writeOCILayer(dir, mediaType string, annotations map[string]string, blob []byte) error {
+	title := annotations[ociTitleAnnotation]
+	if title != "" && annotations[orasUnpackAnnotation] != "true" {
+		return writeOCIFile(dir, title, blob)
+	}
+
+	var r io.Reader = bytes.NewReader(blob)
+	switch {
+	case strings.HasSuffix(mediaType, ".tar+gzip"), strings.HasSuffix(mediaType, ".tar.gzip"):
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		return extractTar(gz, dir, title)
+	case strings.HasSuffix(mediaType, ".tar"):
+		return extractTar(r, dir, title)
+	default:
+		return fmt.Errorf("%s is neither a tar nor has a title annotation", mediaType)
+	}
+}
+
+// parseOCIReference splits oci://<registry>/<repository>[:<tag>|@<digest>], the tag defaults to latest
+func parseOCIReference(ref string) (registry, repository, reference string, err error) {
+	name, _ := strings.CutPrefix(ref, OCIScheme)
+	registry, repository, _ = strings.Cut(name, "/")
+	reference = "latest"
+	if repo, digest, ok := strings.Cut(repository, "@"); ok {
+		repository, reference = repo, digest
+	} else if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository, reference = repository[:i], repository[i+1:]
+	}
+	if !strings.HasPrefix(ref, OCIScheme) || registry == "" || repository == "" || reference == "" {
+		return "", "", "", fmt.Errorf("invalid OCI reference %q, expected %s<registry>/<repository>[:<tag>]", ref,
+			OCIScheme)
+	}
+	return registry, repository, reference, nil
+}
+
+type ociClient struct {
+	base  string
+	token string
+}
+
+// get returns the body of the registry API path, authenticating with an anonymous token when the registry asks
+// for one
+func (c *ociClient) get(ctx context.Context, path string, limit int64, accept ...string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(accept) > 0 {
+			req.Header.Set("Accept", strings.Join(accept, ", "))
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		resp, err := ociHTTPClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && attempt == 0:
+			if c.token, err = c.authenticate(ctx, resp.Header.Get("WWW-Authenticate")); err != nil {
+				return nil, err
+			}
+			continue
+		case resp.StatusCode != http.StatusOK:
+			return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+		case int64(len(data)) > limit:
+			return nil, fmt.Errorf("larger than %d bytes", limit)
+		}
+		return data, nil
+	}
+}
+
+// authenticate returns an anonymous token from the realm of a Bearer WWW-Authenticate challenge
+func (c *ociClient) authenticate(ctx context.Context, challenge string) (string, error) {
+	params, ok := strings.CutPrefix(challenge, "Bearer ")
+	if !ok {
+		return "", fmt.Errorf("unauthorized, only anonymous bearer tokens are supported: %q", challenge)
+	}
+	values := url.Values{}
+	var realm string
+	// the quoted values can contain commas, e.g. scope="repository:org/customizations:pull,push"
+	for _, param := range challengeParam.FindAllStringSubmatch(params, -1) {
+		if param[1] == "realm" {
+			realm = param[2]
+		} else {
+			values.Set(param[1], param[2])
+		}
+	}
+	if realm == "" {
+		return "", fmt.Errorf("unauthorized, no realm in %q", challenge)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+values.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := ociHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get a token from %s: %s", realm, resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOCIManifestSize)).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid token from %s: %w", realm, err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return token.Token, nil
+}
+
+func verifyOCIDigest(digest string, data []byte) error {
+	expected, ok := strings.CutPrefix(digest, "sha256:")
+	if !ok {
+		return fmt.Errorf("unsupported digest %s", digest)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != expected {
+		return fmt.Errorf("digest mismatch, expected %s", digest)
+	}
+	return nil
+}
+
+// extractTar extracts the regular files of the tar into dir, without the leading directory named prefix
+func extractTar(r io.Reader, dir, prefix string) error {
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(header.Name, "./")
+		if prefix != "" {
+			name = strings.TrimPrefix(name, strings.TrimSuffix(prefix, "/")+"/")
+		}
+		data, err := io.ReadAll(io.LimitReader(archive, maxOCILayerSize))
+		if err != nil {
+			return err
+		}
+		if err := writeOCIFile(dir, name, data); err != nil {
+			return err
+		}
+	}
+}
+
+// writeOCIFile writes the file at the slash separated path of an artifact into dir
+func writeOCIFile(dir, name string, data []byte) error {
+	name = filepath.FromSlash(name)
+	if !filepath.IsLocal(name) {
+		return fmt.Errorf("invalid path %q", name)
+	}
+	p := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o600)
+}
@@ -0,0 +1,182 @@
+package lua
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tarGzip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, archive.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0o600,
+			Size:     int64(len(content)),
+		}))
+		_, err := archive.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// serveOCIArtifact serves the layers as the org/customizations:v1 artifact of a registry that requires an
+// anonymous token, and returns the reference of the artifact
+func serveOCIArtifact(t *testing.T, layers ...map[string]any) string {
+	blobs := map[string][]byte{}
+	var manifestLayers []map[string]any
+	for _, layer := range layers {
+		blob := layer["blob"].([]byte)
+		sum := sha256.Sum256(blob)
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		blobs[digest] = blob
+		manifestLayers = append(manifestLayers, map[string]any{
+			"mediaType":   layer["mediaType"],
+			"digest":      digest,
+			"size":        len(blob),
+			"annotations": layer["annotations"],
+		})
+	}
+	manifest, err := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     ociManifestMediaType,
+		"layers":        manifestLayers,
+	})
+	require.NoError(t, err)
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") != "repository:org/customizations:pull,push" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(`{"token": "anonymous"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer anonymous" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+
+				`/token",service="test",scope="repository:org/customizations:pull,push"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/v2/org/customizations/manifests/v1":
+			w.Header().Set("Content-Type", ociManifestMediaType)
+			_, _ = w.Write(manifest)
+		case strings.HasPrefix(r.URL.Path, "/v2/org/customizations/blobs/"):
+			blob, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/org/customizations/blobs/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(blob)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := ociHTTPClient
+	ociHTTPClient = server.Client()
+	t.Cleanup(func() { ociHTTPClient = client })
+	return OCIScheme + strings.TrimPrefix(server.URL, "https://") + "/org/customizations:v1"
+}
+
+func TestLoadCustomizationsOCI(t *testing.T) {
+	ref := serveOCIArtifact(t, map[string]any{
+		// oras push <ref> customizations/
+		"mediaType":   "application/vnd.oci.image.layer.v1.tar+gzip",
+		"annotations": map[string]string{ociTitleAnnotation: "customizations", orasUnpackAnnotation: "true"},
+		"blob": tarGzip(t, map[string]string{
+			"customizations/example.com/Widget/health.lua":          healthScript("Healthy"),
+			"customizations/example.com/Widget/testdata/broken.lua": `return {`,
+		}),
+	}, map[string]any{
+		// oras push <ref> example.com/Gadget/health.lua
+		"mediaType":   "application/vnd.oci.image.layer.v1.tar",
+		"annotations": map[string]string{ociTitleAnnotation: "example.com/Gadget/health.lua"},
+		"blob":        []byte(healthScript("Degraded")),
+	})
+
+	customizations, err := LoadCustomizationsOCI(context.Background(), ref)
+	require.NoError(t, err)
+	defer customizations.Unload()
+	assert.Equal(t, ref, customizations.Path)
+
+	overrides := ResourceHealthOverrides{}
+	for kind, expected := range map[string]health.Health{
+		"Widget": health.HealthHealthy,
+		"Gadget": health.HealthUnhealthy,
+	} {
+		obj := StrToUnstructured(`{"apiVersion": "example.com/v1", "kind": "` + kind +
+			`", "metadata": {"name": "test"}}`)
+		status, err := overrides.GetResourceHealth(obj)
+		require.NoError(t, err, kind)
+		require.NotNil(t, status, kind)
+		assert.Equal(t, expected, status.Health, kind)
+	}
+
+	_, source, err := readCustomization("example.com/Widget/health.lua")
+	require.NoError(t, err)
+	assert.Equal(t, ref+"/example.com/Widget/health.lua", source)
+}
+
+func TestPullOCIArtifactErrors(t *testing.T) {
+	t.Run("path traversal", func(t *testing.T) {
+		ref := serveOCIArtifact(t, map[string]any{
+			"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+			"blob":      tarGzip(t, map[string]string{"../escaped.lua": healthScript("Healthy")}),
+		})
+		err := PullOCIArtifact(context.Background(), ref, t.TempDir())
+		assert.ErrorContains(t, err, `invalid path "../escaped.lua"`)
+	})
+
+	t.Run("unknown tag", func(t *testing.T) {
+		ref := serveOCIArtifact(t, map[string]any{
+			"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+			"blob":      tarGzip(t, nil),
+		})
+		err := PullOCIArtifact(context.Background(), strings.TrimSuffix(ref, ":v1")+":v2", t.TempDir())
+		assert.ErrorContains(t, err, "failed to pull the manifest")
+	})
+}
+
+func TestParseOCIReference(t *testing.T) {
+	for ref, expected := range map[string][3]string{
+		"oci://ghcr.io/org/customizations":            {"ghcr.io", "org/customizations", "latest"},
+		"oci://ghcr.io/org/customizations:v1":         {"ghcr.io", "org/customizations", "v1"},
+		"oci://localhost:5000/customizations:v1":      {"localhost:5000", "customizations", "v1"},
+		"oci://ghcr.io/org/customizations@sha256:abc": {"ghcr.io", "org/customizations", "sha256:abc"},
+	} {
+		registry, repository, reference, err := parseOCIReference(ref)
+		require.NoError(t, err, ref)
+		assert.Equal(t, expected, [3]string{registry, repository, reference}, ref)
+	}
+
+	for _, ref := range []string{
+		"ghcr.io/org/customizations",
+		"oci://ghcr.io",
+		"oci://ghcr.io/org/customizations:",
+	} {
+		_, _, _, err := parseOCIReference(ref)
+		assert.ErrorContains(t, err, "invalid OCI reference", ref)
+	}
+}
@@ -14,25 +14,40 @@ import (
 )
 
 func OpenSafeOs(L *lua.LState) int {
-	tabmod := L.RegisterModule(lua.TabLibName, osFuncs)
-	L.Push(tabmod)
-	return 1
+	return openSafeOs(time.Now)(L)
 }
 
 func SafeOsLoader(L *lua.LState) int {
-	mod := L.SetFuncs(L.NewTable(), osFuncs)
-	L.Push(mod)
-	return 1
+	return safeOsLoader(time.Now)(L)
+}
+
+// openSafeOs returns OpenSafeOs using now as the current time of os.time() and os.date()
+func openSafeOs(now func() time.Time) lua.LGFunction {
+	return func(L *lua.LState) int {
+		tabmod := L.RegisterModule(lua.TabLibName, osFuncs(now))
+		L.Push(tabmod)
+		return 1
+	}
 }
 
-var osFuncs = map[string]lua.LGFunction{
-	"time": osTime,
-	"date": osDate,
+func safeOsLoader(now func() time.Time) lua.LGFunction {
+	return func(L *lua.LState) int {
+		mod := L.SetFuncs(L.NewTable(), osFuncs(now))
+		L.Push(mod)
+		return 1
+	}
+}
+
+func osFuncs(now func() time.Time) map[string]lua.LGFunction {
+	return map[string]lua.LGFunction{
+		"time": func(L *lua.LState) int { return osTime(L, now) },
+		"date": func(L *lua.LState) int { return osDate(L, now) },
+	}
 }
 
-func osTime(L *lua.LState) int {
+func osTime(L *lua.LState, now func() time.Time) int {
 	if L.GetTop() == 0 {
-		L.Push(lua.LNumber(time.Now().Unix()))
+		L.Push(lua.LNumber(now().Unix()))
 	} else {
 		tbl := L.CheckTable(1)
 		sec := getIntField(tbl, "sec", 0)
@@ -68,13 +83,13 @@ func getBoolField(tb *lua.LTable, key string, v bool) bool {
 	return v
 }
 
-func osDate(L *lua.LState) int {
-	t := time.Now()
+func osDate(L *lua.LState, now func() time.Time) int {
+	t := now()
 	cfmt := "%c"
 	if L.GetTop() >= 1 {
 		cfmt = L.CheckString(1)
 		if strings.HasPrefix(cfmt, "!") {
-			t = time.Now().UTC()
+			t = now().UTC()
 			cfmt = strings.TrimLeft(cfmt, "!")
 		}
 		if L.GetTop() >= 2 {
@@ -0,0 +1,225 @@
+package lua
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/samber/lo"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+const scriptName = "<string>"
+
+// maxCompiledScripts bounds the number of compiled scripts that are cached, it is well above the number of embedded
+// resource customizations so that only the scripts of reloaded or generated overrides are evicted
+const maxCompiledScripts = 1024
+
+// protos caches the compiled scripts by the sha256 of their source, evicting the least recently used ones
+var protos = lo.Must(lru.New[[sha256.Size]byte, *lua.FunctionProto](maxCompiledScripts))
+
+// sandboxes are pools of initialized states, indexed by their sandboxOptions
+var sandboxes sync.Map
+
+// sandboxOptions are the options a state is created with
+type sandboxOptions struct {
+	useOpenLibs   bool
+	callStackSize int
+	registrySize  int
+}
+
+// sandbox is a lua state with the safe libraries loaded. Scripts run with their own environment that falls
+// back to the globals of the state, so that globals set by one script are not visible to the next one, and the
+// globals and library tables changed by a script are restored before the state is reused.
+type sandbox struct {
+	l   *lua.LState
+	now func() time.Time
+	// shared are the tables reachable by every script, as they were after loading the libraries
+	shared []tableSnapshot
+}
+
+// tableSnapshot is the content of a table shared by the runs of a sandbox
+type tableSnapshot struct {
+	table     *lua.LTable
+	metatable lua.LValue
+	fields    map[lua.LValue]lua.LValue
+}
+
+func newSandbox(opts sandboxOptions) *sandbox {
+	s := &sandbox{
+		l: lua.NewState(lua.Options{
+			SkipOpenLibs:  !opts.useOpenLibs,
+			CallStackSize: opts.callStackSize,
+			RegistrySize:  opts.registrySize,
+		}),
+		now: time.Now,
+	}
+	// the os functions are bound once per state, read the clock of the current run
+	now := func() time.Time { return s.now() }
+
+	// Opens table library to allow access to functions to manipulate tables
+	for _, pair := range []struct {
+		n string
+		f lua.LGFunction
+	}{
+		{lua.LoadLibName, lua.OpenPackage},
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		// load our 'safe' version of the OS library
+		{lua.OsLibName, openSafeOs(now)},
+	} {
+		if err := s.l.CallByParam(lua.P{
+			Fn:      s.l.NewFunction(pair.f),
+			NRet:    0,
+			Protect: true,
+		}, lua.LString(pair.n)); err != nil {
+			panic(err)
+		}
+	}
+	// preload our 'safe' version of the OS library. Allows the 'local os = require("os")' to work
+	s.l.PreloadModule(lua.OsLibName, safeOsLoader(now))
+	// helpers of the Go health checks, see healthlib.go
+	s.l.PreloadModule(HealthLibName, healthLoader(now))
+	s.shared = snapshotTables(s.l)
+	return s
+}
+
+// snapshotTables records the globals, the tables they reference (the libraries, package.loaded...) and the
+// metatable of strings
+func snapshotTables(l *lua.LState) []tableSnapshot {
+	var snapshots []tableSnapshot
+	seen := map[*lua.LTable]bool{}
+	var walk func(t *lua.LTable, depth int)
+	walk = func(t *lua.LTable, depth int) {
+		if seen[t] {
+			return
+		}
+		seen[t] = true
+		snapshot := tableSnapshot{table: t, metatable: l.GetMetatable(t), fields: map[lua.LValue]lua.LValue{}}
+		var children []*lua.LTable
+		t.ForEach(func(k, v lua.LValue) {
+			snapshot.fields[k] = v
+			if child, ok := v.(*lua.LTable); ok && depth < 2 {
+				children = append(children, child)
+			}
+		})
+		snapshots = append(snapshots, snapshot)
+		for _, child := range children {
+			walk(child, depth+1)
+		}
+	}
+	walk(l.G.Global, 0)
+	if stringMeta, ok := l.GetMetatable(lua.LString("")).(*lua.LTable); ok {
+		walk(stringMeta, 1)
+	}
+	return snapshots
+}
+
+// restore resets the shared tables to their snapshot
+func (s *sandbox) restore() {
+	for _, snapshot := range s.shared {
+		var added []lua.LValue
+		snapshot.table.ForEach(func(k, _ lua.LValue) {
+			if _, ok := snapshot.fields[k]; !ok {
+				added = append(added, k)
+			}
+		})
+		for _, k := range added {
+			snapshot.table.RawSet(k, lua.LNil)
+		}
+		for k, v := range snapshot.fields {
+			snapshot.table.RawSet(k, v)
+		}
+		s.l.SetMetatable(snapshot.table, snapshot.metatable)
+	}
+}
+
+func sandboxPool(opts sandboxOptions) *sync.Pool {
+	if pool, ok := sandboxes.Load(opts); ok {
+		return pool.(*sync.Pool)
+	}
+	pool, _ := sandboxes.LoadOrStore(opts, &sync.Pool{New: func() any { return newSandbox(opts) }})
+	return pool.(*sync.Pool)
+}
+
+func getSandbox(opts sandboxOptions) *sandbox {
+	return sandboxPool(opts).Get().(*sandbox)
+}
+
+func putSandbox(opts sandboxOptions, s *sandbox) {
+	s.now = time.Now
+	s.restore()
+	sandboxPool(opts).Put(s)
+}
+
+// run executes the compiled script with the vars as globals within the limits, returning the last value returned
+// by the script
+func (s *sandbox) run(
+	vars map[string]any,
+	proto *lua.FunctionProto,
+	now func() time.Time,
+	limits Limits,
+) (lua.LValue, error) {
+	s.now = now
+
+	env := s.l.NewTable()
+	meta := s.l.NewTable()
+	meta.RawSetString("__index", s.l.G.Global)
+	s.l.SetMetatable(env, meta)
+	values := make([]lua.LValue, 0, len(vars))
+	for name, v := range vars {
+		value := decodeValue(s.l, v)
+		env.RawSetString(name, value)
+		values = append(values, value)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), limits.Timeout)
+	defer cancel()
+	b := newBudget(ctx, limits, s.l, env, values...)
+	s.l.SetContext(b)
+	defer s.l.RemoveContext()
+
+	fn := s.l.NewFunctionFromProto(proto)
+	fn.Env = env
+	s.l.Push(fn)
+	defer s.l.SetTop(0)
+	if err := s.l.PCall(0, lua.MultRet, nil); err != nil {
+		return nil, b.budgetError(err)
+	}
+	returnValue := s.l.Get(-1)
+	if b.checkTables(returnValue); b.exceeded != "" {
+		return nil, fmt.Errorf("%w: %s", ErrLuaBudgetExceeded, b.exceeded)
+	}
+	return returnValue, nil
+}
+
+// compileLua returns the compiled script, compiling it on the first use
+func compileLua(script string) (*lua.FunctionProto, error) {
+	key := sha256.Sum256([]byte(script))
+	if proto, ok := protos.Get(key); ok {
+		return proto, nil
+	}
+	proto, err := compile(script)
+	if err != nil {
+		return nil, err
+	}
+	protos.Add(key, proto)
+	return proto, nil
+}
+
+func compile(script string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(script), scriptName)
+	if err != nil {
+		return nil, &lua.ApiError{Type: lua.ApiErrorSyntax, Object: lua.LString(err.Error()), Cause: err}
+	}
+	proto, err := lua.Compile(chunk, scriptName)
+	if err != nil {
+		return nil, &lua.ApiError{Type: lua.ApiErrorSyntax, Object: lua.LString(err.Error()), Cause: err}
+	}
+	return proto, nil
+}
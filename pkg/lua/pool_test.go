@@ -0,0 +1,185 @@
+package lua
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flanksource/is-healthy/pkg/resource_customizations"
+)
+
+func TestPooledSandboxIsolation(t *testing.T) {
+	testObj := StrToUnstructured(objJSON)
+	vm := VM{}
+
+	_, err := vm.ExecuteHealthLua(testObj, `leaked = "yes"
+hs = {status = "Healthy", message = obj.metadata.name}
+return hs`)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, err := vm.ExecuteHealthLua(testObj, `hs = {status = "Healthy", message = tostring(leaked)}
+return hs`)
+			assert.NoError(t, err)
+			assert.Equal(t, "nil", status.Message)
+		}()
+	}
+	wg.Wait()
+
+	// a failed run discards the state, the next run gets a working one
+	_, err = vm.ExecuteHealthLua(testObj, infiniteLoop)
+	assert.Error(t, err)
+	status, err := vm.ExecuteHealthLua(testObj, `return {status = "Healthy", message = obj.metadata.name}`)
+	require.NoError(t, err)
+	assert.Equal(t, "helm-guestbook", status.Message)
+
+	_, err = vm.ExecuteHealthLua(testObj, `return {`)
+	assert.Error(t, err)
+}
+
+func TestSandboxRestoresSharedTables(t *testing.T) {
+	opts := sandboxOptions{
+		useOpenLibs:   true,
+		callStackSize: DefaultLimits.CallStackSize,
+		registrySize:  DefaultLimits.RegistrySize,
+	}
+	s := newSandbox(opts)
+	defer s.l.Close()
+	run := func(script string) lua.LValue {
+		proto, err := compileLua(script)
+		require.NoError(t, err)
+		value, err := s.run(nil, proto, time.Now, DefaultLimits)
+		require.NoError(t, err)
+		return value
+	}
+
+	run(`table.insert = nil
+string.upper = function() return "patched" end
+os.leaked = true
+_G.leaked = true
+require("os").clock = nil
+setmetatable(table, {__index = function() return "patched" end})
+getmetatable("").__index = {}
+return {}`)
+	s.restore()
+
+	assert.Equal(t, lua.LString("ok"), run(`
+if table.insert == nil or string.upper("ok") ~= "OK" or ("ok"):upper() ~= "OK" or
+  os.leaked or leaked or os.clock == nil or getmetatable(table) ~= nil or table.missing ~= nil then
+  return "leaked"
+end
+return "ok"`))
+}
+
+func TestCompiledScriptsAreBounded(t *testing.T) {
+	for i := 0; i < maxCompiledScripts+10; i++ {
+		_, err := compileLua(fmt.Sprintf("return %d", i))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, maxCompiledScripts, protos.Len())
+}
+
+type embeddedHealthTest struct {
+	obj         *unstructured.Unstructured
+	script      string
+	useOpenLibs bool
+}
+
+// embeddedHealthTests returns the test inputs of the embedded health scripts
+func embeddedHealthTests(b *testing.B) []embeddedHealthTest {
+	var tests []embeddedHealthTest
+	err := fs.WalkDir(resource_customizations.Embedded, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.Name() != "health_test.yaml" {
+			return err
+		}
+		dir := path.Dir(p)
+		data, err := fs.ReadFile(resource_customizations.Embedded, p)
+		if err != nil {
+			return err
+		}
+		var resourceTest TestStructure
+		if err := yaml.Unmarshal(data, &resourceTest); err != nil {
+			return err
+		}
+		for _, test := range resourceTest.Tests {
+			data, err := fs.ReadFile(resource_customizations.Embedded, path.Join(dir, test.InputPath))
+			if err != nil {
+				return err
+			}
+			obj := &unstructured.Unstructured{}
+			if err := yaml.Unmarshal(data, &obj.Object); err != nil {
+				return err
+			}
+			script, useOpenLibs, err := VM{}.GetHealthScript(obj)
+			if err != nil {
+				return err
+			}
+			// some customizations only have tests, e.g. a misnamed script
+			if script != "" {
+				tests = append(tests, embeddedHealthTest{obj: obj, script: script, useOpenLibs: useOpenLibs})
+			}
+		}
+		return nil
+	})
+	require.NoError(b, err)
+	require.NotEmpty(b, tests)
+	return tests
+}
+
+func BenchmarkExecuteHealthLua(b *testing.B) {
+	tests := embeddedHealthTests(b)
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			test := tests[i%len(tests)]
+			vm := VM{UseOpenLibs: test.useOpenLibs}
+			if _, err := vm.runLua(test.obj, test.script, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	// the previous behaviour: a new state and a parsed script on every call
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			test := tests[i%len(tests)]
+			proto, err := compile(test.script)
+			if err != nil {
+				b.Fatal(err)
+			}
+			s := newSandbox(sandboxOptions{useOpenLibs: test.useOpenLibs})
+			if _, err := s.run(map[string]any{"obj": test.obj.Object}, proto, time.Now, DefaultLimits); err != nil {
+				b.Fatal(err)
+			}
+			s.l.Close()
+		}
+	})
+}
+
+func BenchmarkGetResourceHealth(b *testing.B) {
+	tests := embeddedHealthTests(b)
+	overrides := ResourceHealthOverrides{}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			if _, err := overrides.GetResourceHealth(tests[i%len(tests)].obj); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -2,9 +2,13 @@ package lua
 
 import (
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
 
-	"gopkg.in/yaml.v2"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
 )
 
 type KnownTypeField struct {
@@ -127,6 +131,63 @@ type ResourceActionParam struct {
 	Default string `json:"default,omitempty" protobuf:"bytes,4,opt,name=default"`
 }
 
+// ResolveParams returns the declared params of the action with the given values. Params without a value use
+// their default, unknown params, missing required params and values not matching the declared type are rejected.
+func (a ResourceAction) ResolveParams(values map[string]string) ([]ResourceActionParam, error) {
+	declared := make(map[string]bool, len(a.Params))
+	for _, param := range a.Params {
+		declared[param.Name] = true
+	}
+	for name := range values {
+		if !declared[name] {
+			return nil, fmt.Errorf("action %s has no parameter %s", a.Name, name)
+		}
+	}
+
+	params := make([]ResourceActionParam, 0, len(a.Params))
+	for _, param := range a.Params {
+		if value, ok := values[param.Name]; ok {
+			param.Value = value
+		}
+		if param.Value == "" && param.Default == "" {
+			return nil, fmt.Errorf("action %s requires the parameter %s", a.Name, param.Name)
+		}
+		if _, err := param.TypedValue(); err != nil {
+			return nil, fmt.Errorf("action %s: %w", a.Name, err)
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+// TypedValue converts the value of the param, or its default when empty, to its type: string, number, integer
+// or boolean
+func (p ResourceActionParam) TypedValue() (any, error) {
+	value := p.Value
+	if value == "" {
+		value = p.Default
+	}
+	switch strings.ToLower(p.Type) {
+	case "", "string":
+		return value, nil
+	case "number":
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n, nil
+		}
+	case "integer", "int":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n, nil
+		}
+	case "boolean", "bool":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b, nil
+		}
+	default:
+		return nil, fmt.Errorf("parameter %s has an unsupported type %s", p.Name, p.Type)
+	}
+	return nil, fmt.Errorf("parameter %s expects a value of type %s, not %q", p.Name, p.Type, value)
+}
+
 // UnmarshalToUnstructured unmarshals a resource representation in JSON to unstructured data
 func UnmarshalToUnstructured(resource string) (*unstructured.Unstructured, error) {
 	if resource == "" || resource == "null" {
@@ -139,3 +200,16 @@ func UnmarshalToUnstructured(resource string) (*unstructured.Unstructured, error
 	}
 	return &obj, nil
 }
+
+// GetIgnoreDifferences returns the ignoreDifferences of every override matching the group/kind, either
+// exactly or through a wildcard key
+func (overrides ResourceHealthOverrides) GetIgnoreDifferences(gvk schema.GroupVersionKind) []OverrideIgnoreDiff {
+	key := GetConfigMapKey(gvk)
+	var rules []OverrideIgnoreDiff
+	for k, override := range overrides {
+		if k == key || Match(k, key) {
+			rules = append(rules, override.IgnoreDifferences)
+		}
+	}
+	return rules
+}
@@ -0,0 +1,396 @@
+package lua
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+)
+
+const (
+	healthTestFile = "health_test.yaml"
+	actionTestFile = "action_test.yaml"
+)
+
+// anyTimestamp matches any timestamp in the expected output of an action, as the timestamps set by the actions
+// with os.date, e.g. kubectl.kubernetes.io/restartedAt, change on every run
+const anyTimestamp = "0001-01-01T00:00:00Z"
+
+var timestamp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z$`)
+
+// TestStructure is the content of a health_test.yaml, next to the health.lua it tests
+type TestStructure struct {
+	Tests []IndividualTest `yaml:"tests" json:"tests"`
+}
+
+// IndividualTest is the expected health of the object at InputPath, relative to the health_test.yaml
+type IndividualTest struct {
+	InputPath    string              `yaml:"inputPath"    json:"inputPath"`
+	HealthStatus health.HealthStatus `yaml:"healthStatus" json:"healthStatus"`
+}
+
+// ActionTestStructure is the content of an action_test.yaml, in the actions directory it tests
+type ActionTestStructure struct {
+	DiscoveryTests []IndividualDiscoveryTest `yaml:"discoveryTests" json:"discoveryTests"`
+	ActionTests    []IndividualActionTest    `yaml:"actionTests"    json:"actionTests"`
+}
+
+// IndividualDiscoveryTest lists the actions expected to be discovered for the object at InputPath
+type IndividualDiscoveryTest struct {
+	InputPath string           `yaml:"inputPath" json:"inputPath"`
+	Result    []ResourceAction `yaml:"result"    json:"result"`
+}
+
+// IndividualActionTest runs Action on the object at InputPath, the impacted resources are expected in the
+// ExpectedOutputPath
+type IndividualActionTest struct {
+	Action             string `yaml:"action"             json:"action"`
+	InputPath          string `yaml:"inputPath"          json:"inputPath"`
+	ExpectedOutputPath string `yaml:"expectedOutputPath" json:"expectedOutputPath"`
+	InputStr           string `yaml:"input"              json:"input"`
+	// Parameters are resolved against the params returned by the discovery script
+	Parameters map[string]string `yaml:"parameters"         json:"parameters"`
+}
+
+// CustomizationTestResult is the outcome of a test of a health_test.yaml or action_test.yaml
+type CustomizationTestResult struct {
+	// Suite is the directory of the test file, relative to the tested directory
+	Suite string `json:"suite"`
+	// Name identifies the test within the suite, e.g. health/testdata/healthy.yaml or
+	// action/restart/testdata/rollout.yaml
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	// Failure describes why the test failed, it is empty if the test passed
+	Failure string `json:"failure,omitempty"`
+}
+
+func (r CustomizationTestResult) Passed() bool {
+	return r.Failure == ""
+}
+
+// RunCustomizationTests runs every health_test.yaml and action_test.yaml under the directory against the scripts
+// next to them, i.e. health.lua, actions/discovery.lua and actions/<action>/action.lua
+func RunCustomizationTests(dir string) ([]CustomizationTestResult, error) {
+	var results []CustomizationTestResult
+	err := walkCustomizations(dir, func(p string) error {
+		suite, err := filepath.Rel(dir, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		switch filepath.Base(p) {
+		case healthTestFile:
+			results = append(results, runHealthTests(filepath.Dir(p), filepath.ToSlash(suite))...)
+		case actionTestFile:
+			results = append(results, runActionTests(filepath.Dir(p), filepath.ToSlash(suite))...)
+		}
+		return nil
+	})
+	return results, err
+}
+
+// walkCustomizations calls fn for every file under dir outside of the testdata directories
+func walkCustomizations(dir string, fn func(p string) error) error {
+	return filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == "testdata" {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		return fn(p)
+	})
+}
+
+func runHealthTests(dir, suite string) []CustomizationTestResult {
+	var tests TestStructure
+	if err := readTestFile(filepath.Join(dir, healthTestFile), &tests); err != nil {
+		return []CustomizationTestResult{{Suite: suite, Name: healthTestFile, Failure: err.Error()}}
+	}
+	script, scriptErr := os.ReadFile(filepath.Join(dir, healthScriptFile))
+
+	var results []CustomizationTestResult
+	for _, test := range tests.Tests {
+		results = append(results, runTest(suite, "health/"+test.InputPath, func() error {
+			if scriptErr != nil {
+				return scriptErr
+			}
+			obj, err := readTestObject(filepath.Join(dir, test.InputPath))
+			if err != nil {
+				return err
+			}
+			vm := VM{UseOpenLibs: true}
+			actual, err := vm.ExecuteHealthLua(obj, string(script))
+			if err != nil {
+				return err
+			}
+			expected := test.HealthStatus
+			normalizeHealthStatus(&expected)
+			if !reflect.DeepEqual(expected, *actual) {
+				return fmt.Errorf("expected %s, got %s", toJSON(expected), toJSON(actual))
+			}
+			return nil
+		}))
+	}
+	return results
+}
+
+func runActionTests(dir, suite string) []CustomizationTestResult {
+	var tests ActionTestStructure
+	if err := readTestFile(filepath.Join(dir, actionTestFile), &tests); err != nil {
+		return []CustomizationTestResult{{Suite: suite, Name: actionTestFile, Failure: err.Error()}}
+	}
+	discovery, discoveryErr := os.ReadFile(filepath.Join(dir, actionDiscoveryScriptFile))
+
+	var results []CustomizationTestResult
+	for _, test := range tests.DiscoveryTests {
+		results = append(results, runTest(suite, "discovery/"+test.InputPath, func() error {
+			if discoveryErr != nil {
+				return discoveryErr
+			}
+			obj, err := readTestObject(filepath.Join(dir, test.InputPath))
+			if err != nil {
+				return err
+			}
+			vm := VM{UseOpenLibs: true}
+			actions, err := vm.ExecuteResourceActionDiscovery(obj, string(discovery))
+			if err != nil {
+				return err
+			}
+			return diffActions(test.Result, actions)
+		}))
+	}
+
+	for _, test := range tests.ActionTests {
+		name := fmt.Sprintf("action/%s/%s", test.Action, test.InputPath)
+		results = append(results, runTest(suite, name, func() error {
+			script, err := os.ReadFile(filepath.Join(dir, test.Action, actionScriptFile))
+			if err != nil {
+				return err
+			}
+			obj, err := readTestObject(filepath.Join(dir, test.InputPath))
+			if err != nil {
+				return err
+			}
+
+			vm := VM{}
+			var params []ResourceActionParam
+			if len(test.Parameters) > 0 {
+				if discoveryErr != nil {
+					return discoveryErr
+				}
+				actions, err := vm.ExecuteResourceActionDiscovery(obj, string(discovery))
+				if err != nil {
+					return err
+				}
+				i := slices.IndexFunc(actions, func(a ResourceAction) bool { return a.Name == test.Action })
+				if i < 0 {
+					return fmt.Errorf("action %s is not discovered", test.Action)
+				}
+				if params, err = actions[i].ResolveParams(test.Parameters); err != nil {
+					return err
+				}
+			}
+
+			impacted, err := vm.ExecuteResourceAction(obj, string(script), params...)
+			if err != nil {
+				return err
+			}
+			expected, err := readExpectedObjects(filepath.Join(dir, test.ExpectedOutputPath))
+			if err != nil {
+				return err
+			}
+			for _, resource := range impacted {
+				i := slices.IndexFunc(expected, func(u *unstructured.Unstructured) bool {
+					return isExpectedObject(obj, resource.UnstructuredObj, u)
+				})
+				if i < 0 {
+					return fmt.Errorf("unexpected %s %s/%s", resource.K8SOperation,
+						resource.UnstructuredObj.GetKind(), resource.UnstructuredObj.GetName())
+				}
+				actual := resource.UnstructuredObj
+				if hasGeneratedName(obj, actual) {
+					actual = actual.DeepCopy()
+					actual.SetName(expected[i].GetName())
+				}
+				if diff := diffObjects(expected[i].Object, actual.Object); len(diff) > 0 {
+					return fmt.Errorf("%s %s/%s does not match %s:\n%s", resource.K8SOperation,
+						resource.UnstructuredObj.GetKind(), resource.UnstructuredObj.GetName(), test.ExpectedOutputPath,
+						strings.Join(diff, "\n"))
+				}
+			}
+			return nil
+		}))
+	}
+	return results
+}
+
+func runTest(suite, name string, test func() error) CustomizationTestResult {
+	start := time.Now()
+	result := CustomizationTestResult{Suite: suite, Name: name}
+	if err := test(); err != nil {
+		result.Failure = err.Error()
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// isExpectedObject returns true if the resource impacted by the action on source is the expected object. The names
+// of the Jobs and Workflows created from CronJobs, CronWorkflows and WorkflowTemplates are generated, they only
+// need to start with the name of the source.
+func isExpectedObject(source, impacted, expected *unstructured.Unstructured) bool {
+	if expected.GroupVersionKind() != impacted.GroupVersionKind() ||
+		expected.GetNamespace() != impacted.GetNamespace() {
+		return false
+	}
+	if hasGeneratedName(source, impacted) {
+		return strings.HasPrefix(expected.GetName(), source.GetName())
+	}
+	return expected.GetName() == impacted.GetName()
+}
+
+func hasGeneratedName(source, impacted *unstructured.Unstructured) bool {
+	switch impacted.GetKind() {
+	case "Job":
+		return source.GetKind() == "CronJob"
+	case "Workflow":
+		return source.GetKind() == "CronWorkflow" || source.GetKind() == "WorkflowTemplate"
+	}
+	return false
+}
+
+// diffActions returns an error listing the expected actions that are not discovered and the discovered actions that
+// are not expected, regardless of their order
+func diffActions(expected, discovered []ResourceAction) error {
+	missing := lo.CountValues(lo.Map(expected, func(a ResourceAction, _ int) string { return toJSON(a) }))
+	var unexpected []string
+	for _, action := range discovered {
+		if key := toJSON(action); missing[key] > 0 {
+			missing[key]--
+		} else {
+			unexpected = append(unexpected, key)
+		}
+	}
+	var problems []string
+	for _, action := range expected {
+		if key := toJSON(action); missing[key] > 0 {
+			missing[key]--
+			problems = append(problems, "missing action "+key)
+		}
+	}
+	for _, action := range unexpected {
+		problems = append(problems, "unexpected action "+action)
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// diffObjects returns the fields at which the actual object differs from the expected one, as
+// "<path>: expected <value>, got <value>". Both are round-tripped through JSON first, as the lua VM returns float64
+// numbers where the YAML of the expected object has ints.
+func diffObjects(expected, actual map[string]any) []string {
+	var diff []string
+	compareValues("", normalizeJSON(expected), normalizeJSON(actual), &diff)
+	return diff
+}
+
+func normalizeJSON(v any) any {
+	var normalized any
+	_ = json.Unmarshal([]byte(toJSON(v)), &normalized)
+	return normalized
+}
+
+func compareValues(path string, expected, actual any, diff *[]string) {
+	expectedMap, expectedIsMap := expected.(map[string]any)
+	actualMap, actualIsMap := actual.(map[string]any)
+	if expectedIsMap && actualIsMap {
+		keys := lo.Uniq(append(lo.Keys(expectedMap), lo.Keys(actualMap)...))
+		slices.Sort(keys)
+		for _, key := range keys {
+			compareValues(path+"."+key, expectedMap[key], actualMap[key], diff)
+		}
+		return
+	}
+	expectedSlice, expectedIsSlice := expected.([]any)
+	actualSlice, actualIsSlice := actual.([]any)
+	if expectedIsSlice && actualIsSlice && len(expectedSlice) == len(actualSlice) {
+		for i := range expectedSlice {
+			compareValues(fmt.Sprintf("%s[%d]", path, i), expectedSlice[i], actualSlice[i], diff)
+		}
+		return
+	}
+	if s, ok := actual.(string); ok && expected == anyTimestamp && timestamp.MatchString(s) {
+		return
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		*diff = append(*diff, fmt.Sprintf("%s: expected %s, got %s", path, toJSON(expected), toJSON(actual)))
+	}
+}
+
+// readExpectedObjects reads the expected output of an action, either a list of impacted resources of a new-style
+// action or the object returned by an old-style action
+func readExpectedObjects(path string) ([]*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "-") {
+		var resources []struct {
+			UnstructuredObj map[string]any `json:"unstructuredObj"`
+		}
+		if err := yaml.Unmarshal(data, &resources); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		var objects []*unstructured.Unstructured
+		for _, resource := range resources {
+			objects = append(objects, &unstructured.Unstructured{Object: resource.UnstructuredObj})
+		}
+		return objects, nil
+	}
+	obj, err := readTestObject(path)
+	if err != nil {
+		return nil, err
+	}
+	return []*unstructured.Unstructured{obj}, nil
+}
+
+func readTestFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func readTestObject(path string) (*unstructured.Unstructured, error) {
+	obj := map[string]any{}
+	if err := readTestFile(path, &obj); err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: obj}, nil
+}
+
+func toJSON(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,112 @@
+package lua
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const widgetJSON = `{"apiVersion": "example.com/v1", "kind": "Widget", "metadata": {"name": "test"}, "spec": {}}`
+
+func TestRunCustomizationTests(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "example.com/Widget/health.lua", healthScript("Degraded"))
+	writeScript(t, dir, "example.com/Widget/testdata/widget.yaml", widgetJSON)
+	writeScript(t, dir, "example.com/Widget/testdata/other.yaml", widgetJSON)
+	writeScript(t, dir, "example.com/Widget/health_test.yaml", `tests:
+- inputPath: testdata/widget.yaml
+  healthStatus:
+    status: Degraded
+    message: Widget
+- inputPath: testdata/widget.yaml
+  healthStatus:
+    status: Healthy
+    message: Widget`)
+	writeScript(t, dir, "example.com/Widget/actions/discovery.lua", `return {restart = {}}`)
+	writeScript(t, dir, "example.com/Widget/actions/restart/action.lua", `local os = require("os")
+obj.spec = {
+  replicas = 3,
+  restartedAt = os.date("!%Y-%m-%dT%XZ"),
+}
+return obj`)
+	writeScript(t, dir, "example.com/Widget/actions/testdata/restarted.yaml", `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: test
+spec:
+  replicas: 3
+  restartedAt: "0001-01-01T00:00:00Z"`)
+	writeScript(t, dir, "example.com/Widget/actions/action_test.yaml", `discoveryTests:
+- inputPath: ../testdata/widget.yaml
+  result:
+  - name: restart
+- inputPath: ../testdata/other.yaml
+  result:
+  - name: stop
+actionTests:
+- action: restart
+  inputPath: ../testdata/widget.yaml
+  expectedOutputPath: testdata/restarted.yaml
+- action: restart
+  inputPath: ../testdata/other.yaml
+  expectedOutputPath: ../testdata/widget.yaml
+- action: stop
+  inputPath: ../testdata/widget.yaml
+  expectedOutputPath: testdata/restarted.yaml`)
+
+	results, err := RunCustomizationTests(dir)
+	require.NoError(t, err)
+	failures := lo.SliceToMap(results, func(r CustomizationTestResult) (string, string) {
+		return r.Suite + " " + r.Name, r.Failure
+	})
+	assert.Len(t, results, 7)
+	assert.Equal(t, "", failures["example.com/Widget/actions discovery/../testdata/widget.yaml"])
+	assert.Equal(t, `missing action {"name":"stop"}
+unexpected action {"name":"restart"}`, failures["example.com/Widget/actions discovery/../testdata/other.yaml"])
+	assert.Equal(t, "", failures["example.com/Widget/actions action/restart/../testdata/widget.yaml"])
+	mismatch := failures["example.com/Widget/actions action/restart/../testdata/other.yaml"]
+	assert.Contains(t, mismatch, `patch Widget/test does not match ../testdata/widget.yaml:
+.spec.replicas: expected null, got 3
+.spec.restartedAt: expected null, got "`)
+	assert.Contains(t, failures["example.com/Widget/actions action/stop/../testdata/widget.yaml"], "no such file")
+	assert.Equal(t, 1, lo.CountBy(results, func(r CustomizationTestResult) bool {
+		return r.Name == "health/testdata/widget.yaml" && r.Passed()
+	}))
+
+	t.Run("embedded", func(t *testing.T) {
+		results, err := RunCustomizationTests("../resource_customizations/argoproj.io/Rollout")
+		require.NoError(t, err)
+		assert.NotEmpty(t, results)
+		for _, result := range results {
+			assert.True(t, result.Passed(), "%s %s: %s", result.Suite, result.Name, result.Failure)
+		}
+	})
+}
+
+func TestLintCustomizations(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "example.com/Widget/health.lua", healthScript("Healthy"))
+	writeScript(t, dir, "example.com/Widget/health_test.yaml", `tests:
+- inputPath: testdata/missing.yaml`)
+	writeScript(t, dir, "example.com/Gadget/heatlh.lua", healthScript("Healthy"))
+	writeScript(t, dir, "example.com/Gadget/health_test.yaml", `tests: []`)
+	writeScript(t, dir, "example.com/Gadget/actions/discovery.lua", `return {`)
+	writeScript(t, dir, "example.com/Gadget/actions/restart/restart.lua", `return obj`)
+	writeScript(t, dir, "example.com/Gadget/testdata/ignored.lua", `return {`)
+
+	issues, err := LintCustomizations(dir)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"example.com/Widget/health_test.yaml: missing inputPath testdata/missing.yaml",
+		"example.com/Gadget/heatlh.lua: script is never loaded, expected health.lua",
+		"example.com/Gadget/health_test.yaml: tests without a health.lua",
+		"example.com/Gadget/actions/restart/restart.lua: script is never loaded, expected action.lua",
+	}, lo.Map(lo.Filter(issues, func(i LintIssue, _ int) bool {
+		return i.Path != "example.com/Gadget/actions/discovery.lua"
+	}), func(i LintIssue, _ int) string { return i.String() }))
+	assert.True(t, lo.ContainsBy(issues, func(i LintIssue) bool {
+		return i.Path == "example.com/Gadget/actions/discovery.lua"
+	}), "syntax errors are reported")
+}
@@ -1,5 +1,6 @@
 local actions = {}
 actions["restart"] = {["disabled"] = false}
+actions["scale"] = {["params"] = {{["name"] = "replicas", ["type"] = "integer"}}}
 
 local paused = false
 if obj.status ~= nil and obj.status.pauseConditions ~= nil then
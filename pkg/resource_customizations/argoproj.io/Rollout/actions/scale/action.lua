@@ -0,0 +1,6 @@
+local replicas = actionParams["replicas"]
+if replicas == nil or replicas < 0 or replicas % 1 ~= 0 then
+    error("replicas must be a non-negative integer", 0)
+end
+obj.spec.replicas = replicas
+return obj
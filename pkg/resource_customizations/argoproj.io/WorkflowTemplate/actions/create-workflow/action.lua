@@ -22,6 +22,16 @@ workflow.spec = {}
 workflow.spec.workflowTemplateRef = {}
 workflow.spec.workflowTemplateRef.name = obj.metadata.name
 
+-- pass the arguments overridden by the action parameters
+if actionParams ~= nil and next(actionParams) ~= nil and obj.spec.arguments ~= nil and obj.spec.arguments.parameters ~= nil then
+  local parameters = {}
+  for i, parameter in ipairs(obj.spec.arguments.parameters) do
+    parameters[i] = {["name"] = parameter.name, ["value"] = actionParams[parameter.name] or parameter.value}
+  end
+  workflow.spec.arguments = {}
+  workflow.spec.arguments.parameters = parameters
+end
+
 local ownerRef = {}
 ownerRef.apiVersion = obj.apiVersion
 ownerRef.kind = obj.kind
@@ -3,4 +3,13 @@ actions["create-workflow"] = {
   ["iconClass"] = "fa fa-fw fa-play",
   ["displayName"] = "Create Workflow"
 }
-return actions
\ No newline at end of file
+
+-- the arguments of the template can be overridden, their value is the default
+if obj.spec.arguments ~= nil and obj.spec.arguments.parameters ~= nil then
+  local params = {}
+  for i, parameter in ipairs(obj.spec.arguments.parameters) do
+    params[i] = {["name"] = parameter.name, ["default"] = parameter.value}
+  end
+  actions["create-workflow"]["params"] = params
+end
+return actions
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type result struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Key       string `json:"-"`
+
+	*health.HealthStatus
+}
+
+func evaluate(objects []*unstructured.Unstructured) ([]result, error) {
+	return evaluateWithOptions(objects, health.Options{Override: overrides})
+}
+
+func evaluateWithOptions(objects []*unstructured.Unstructured, opts health.Options) ([]result, error) {
+	if opts.Endpoints == nil {
+		// Services are evaluated from the Endpoints and EndpointSlices in the same input
+		opts.Endpoints = health.NewEndpointIndex(objects...)
+	}
+	var results []result
+	for _, obj := range objects {
+		_health, err := health.GetResourceHealthWithOptions(obj, opts)
+		if err != nil {
+			if len(objects) == 1 {
+				return nil, err
+			}
+			// don't let a single bad object hide the health of the rest of the set
+			_health = &health.HealthStatus{
+				Health:  health.HealthUnknown,
+				Status:  health.HealthStatusUnknown,
+				Message: err.Error(),
+			}
+		}
+		results = append(results, newResult(obj, _health))
+	}
+	return results, nil
+}
+
+func newResult(obj *unstructured.Unstructured, hr *health.HealthStatus) result {
+	return result{
+		Kind:         obj.GetKind(),
+		Namespace:    obj.GetNamespace(),
+		Name:         obj.GetName(),
+		Key:          objectKey(obj),
+		HealthStatus: hr,
+	}
+}
+
+func worstHealth(results []result) health.Health {
+	worst := health.HealthUnknown
+	for _, r := range results {
+		worst = worst.Worst(r.Health)
+	}
+	return worst
+}
+
+// exitWithWorstHealth exits with 1 if any result is unhealthy, or 2 if any result has a warning
+func exitWithWorstHealth(results []result) {
+	worst := worstHealth(results)
+	if worst.IsWorseThan(health.HealthUnhealthy) {
+		os.Exit(1)
+	}
+	if worst.IsWorseThan(health.HealthWarning) {
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/flanksource/is-healthy/pkg/lua"
+	"github.com/samber/lo"
+	"github.com/spf13/cobra"
+)
+
+// OutputJUnit is only supported by the test command
+const OutputJUnit = "junit"
+
+func newTestCommand() *cobra.Command {
+	var lint bool
+	cmd := &cobra.Command{
+		Use:   "test <dir>",
+		Short: "Run the health_test.yaml and action_test.yaml of a directory of resource customizations",
+		Long: `Runs every health_test.yaml and action_test.yaml under the directory against the health.lua,
+actions/discovery.lua and actions/<action>/action.lua next to them, and exits with 1 if any test fails. Use -o junit
+for a JUnit XML report.
+
+With --lint, the directory is checked instead for scripts that are never loaded (e.g. a misspelled health.lua),
+syntax errors, tests without the script they test and tests referencing missing files.`,
+		Example: `  is-healthy test ./customizations -o table
+  is-healthy test ./customizations --lint`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format := outputFormat
+			if format != OutputJUnit || jsonOut {
+				var err error
+				if format, err = getOutputFormat(); err != nil {
+					return err
+				}
+			}
+
+			if lint {
+				issues, err := lua.LintCustomizations(args[0])
+				if err != nil {
+					return err
+				}
+				if err := printLintIssues(os.Stdout, format, issues); err != nil {
+					return err
+				}
+				if len(issues) > 0 {
+					os.Exit(1)
+				}
+				return nil
+			}
+
+			results, err := lua.RunCustomizationTests(args[0])
+			if err != nil {
+				return err
+			}
+			if err := printTestResults(os.Stdout, format, results); err != nil {
+				return err
+			}
+			if lo.ContainsBy(results, func(r lua.CustomizationTestResult) bool { return !r.Passed() }) {
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&lint, "lint", false, "Lint the directory instead of running its tests")
+	return cmd
+}
+
+func printTestResults(w io.Writer, format string, results []lua.CustomizationTestResult) error {
+	switch format {
+	case OutputJUnit:
+		return printJUnit(w, results)
+	case OutputJSON, OutputNDJSON, OutputYAML:
+		return printItems(w, format, results)
+	case OutputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "SUITE\tTEST\tRESULT\tDURATION\tMESSAGE")
+		for _, r := range results {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+				r.Suite, r.Name, lo.Ternary(r.Passed(), "PASS", "FAIL"), r.Duration, r.Failure)
+		}
+		return tw.Flush()
+	}
+
+	// only the failures and a summary
+	failed := lo.Filter(results, func(r lua.CustomizationTestResult, _ int) bool { return !r.Passed() })
+	for _, r := range failed {
+		if _, err := fmt.Fprintf(w, "FAIL %s %s: %s\n", r.Suite, r.Name, r.Failure); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d passed, %d failed\n", len(results)-len(failed), len(failed))
+	return err
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// printJUnit prints the results as a JUnit XML report with a test suite per directory
+func printJUnit(w io.Writer, results []lua.CustomizationTestResult) error {
+	report := junitTestSuites{Tests: len(results)}
+	for _, suite := range lo.GroupBy(results, func(r lua.CustomizationTestResult) string { return r.Suite }) {
+		s := junitTestSuite{Name: suite[0].Suite, Tests: len(suite)}
+		var seconds float64
+		for _, r := range suite {
+			c := junitTestCase{Name: r.Name, Classname: r.Suite, Time: fmt.Sprintf("%.3f", r.Duration.Seconds())}
+			if !r.Passed() {
+				c.Failure = &junitFailure{Message: strings.SplitN(r.Failure, "\n", 2)[0], Text: r.Failure}
+				s.Failures++
+			}
+			seconds += r.Duration.Seconds()
+			s.Cases = append(s.Cases, c)
+		}
+		s.Time = fmt.Sprintf("%.3f", seconds)
+		report.Failures += s.Failures
+		report.Suites = append(report.Suites, s)
+	}
+	// map iteration order is random
+	slices.SortFunc(report.Suites, func(a, b junitTestSuite) int { return strings.Compare(a.Name, b.Name) })
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+func printLintIssues(w io.Writer, format string, issues []lua.LintIssue) error {
+	switch format {
+	case OutputJSON, OutputNDJSON, OutputYAML:
+		return printItems(w, format, issues)
+	case OutputJUnit:
+		return fmt.Errorf("unsupported output format %q for --lint", format)
+	}
+	for _, issue := range issues {
+		if _, err := fmt.Fprintln(w, issue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// exitWaitTimeout is distinct from the exit codes of a warning (2) and of the other errors (3) so that pipelines can
+// tell them apart
+const exitWaitTimeout = 4
+
+var (
+	errWaitTimeout = errors.New("timed out")
+	errWaitFailed  = errors.New("reached a terminal unhealthy state")
+)
+
+type waitOptions struct {
+	file     string
+	command  string
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func newWaitCommand() *cobra.Command {
+	opts := waitOptions{}
+	cmd := &cobra.Command{
+		Use:   "wait [-f file | -c command | -- command args...]",
+		Short: "Poll resources until they are healthy and ready",
+		Long: `Re-reads the input on every interval and re-evaluates its health until every object is ready and healthy.
+
+Exits with 0 once all objects are ready and healthy, 1 if any object reaches a terminal unhealthy state
+(ready and unhealthy) and 4 if the timeout is reached first. 2 is not used as it means a warning for the other
+commands, and 3 is used for the other errors such as an invalid flag.`,
+		Example: `  is-healthy wait -c "kubectl get deployment nginx -o yaml" --timeout 5m
+  is-healthy wait --timeout 2m -- kubectl get pods -l app=nginx -o yaml
+  is-healthy wait -f status.yaml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.file == "" && opts.command == "" && len(args) == 0 {
+				return fmt.Errorf("one of --file, --command or a command after -- is required")
+			}
+
+			err := runWait(opts, args)
+			switch {
+			case errors.Is(err, errWaitFailed):
+				fmt.Println(err)
+				os.Exit(1)
+			case errors.Is(err, errWaitTimeout):
+				fmt.Println(err)
+				os.Exit(exitWaitTimeout)
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.file, "file", "f", "", "File to re-read on every interval")
+	cmd.Flags().StringVarP(&opts.command, "command", "c", "",
+		"Shell command whose output is evaluated on every interval")
+	cmd.Flags().DurationVar(&opts.interval, "interval", 2*time.Second, "Polling interval")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 5*time.Minute, "Maximum time to wait, 0 to wait forever")
+	return cmd
+}
+
+func runWait(opts waitOptions, args []string) error {
+	start := time.Now()
+	observed := make(map[string]string)
+
+	for {
+		objects, err := readWaitInput(opts, args)
+		if err != nil {
+			fmt.Printf("%s: %v\n", elapsed(start), err)
+		} else if len(objects) == 0 {
+			fmt.Printf("%s: no objects found in input\n", elapsed(start))
+		} else {
+			results, err := evaluate(objects)
+			if err != nil {
+				// e.g. an object that is only partially written, retry on the next interval
+				fmt.Printf("%s: %v\n", elapsed(start), err)
+			}
+
+			for _, r := range results {
+				state := fmt.Sprintf("%s ready=%t", *r.HealthStatus, r.Ready)
+				if observed[r.Key] != state {
+					fmt.Printf("%s: %s: %s\n", elapsed(start), r.Key, state)
+					observed[r.Key] = state
+				}
+			}
+
+			if failed := terminalFailures(results); len(failed) > 0 {
+				return fmt.Errorf("%s %w", strings.Join(failed, ", "), errWaitFailed)
+			}
+
+			if err == nil && allReady(results) {
+				return nil
+			}
+		}
+
+		interval := opts.interval
+		if opts.timeout > 0 {
+			remaining := opts.timeout - time.Since(start)
+			if remaining <= 0 {
+				return fmt.Errorf("%w after %s waiting for resources to become healthy", errWaitTimeout, opts.timeout)
+			}
+			// the input is evaluated a last time once the timeout is reached
+			interval = min(interval, remaining)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func readWaitInput(opts waitOptions, args []string) ([]*unstructured.Unstructured, error) {
+	if opts.file != "" {
+		f, err := os.Open(opts.file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readObjects(f)
+	}
+
+	var cmd *exec.Cmd
+	if opts.command != "" {
+		cmd = exec.Command("sh", "-c", opts.command)
+	} else {
+		cmd = exec.Command(args[0], args[1:]...)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return readObjects(bytes.NewReader(out))
+}
+
+// terminalFailures returns the objects that are unhealthy and ready, i.e. are not expected to change without
+// intervention
+func terminalFailures(results []result) []string {
+	var failed []string
+	for _, r := range results {
+		if r.Ready && r.Health == health.HealthUnhealthy {
+			failed = append(failed, r.Key)
+		}
+	}
+	return failed
+}
+
+func allReady(results []result) bool {
+	for _, r := range results {
+		if !r.Ready || r.Health != health.HealthHealthy {
+			return false
+		}
+	}
+	return true
+}
+
+func elapsed(start time.Time) string {
+	return time.Since(start).Truncate(time.Second).String()
+}
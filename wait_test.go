@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flanksource/is-healthy/pkg/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func waitResult(key string, h health.Health, ready bool) result {
+	return result{Key: key, HealthStatus: &health.HealthStatus{Health: h, Ready: ready}}
+}
+
+func TestTerminalFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []result
+		failed  []string
+	}{
+		{name: "none"},
+		{
+			name:    "unhealthy and ready",
+			results: []result{waitResult("Pod/a", health.HealthUnhealthy, true)},
+			failed:  []string{"Pod/a"},
+		},
+		{
+			name:    "unhealthy and progressing",
+			results: []result{waitResult("Pod/a", health.HealthUnhealthy, false)},
+		},
+		{
+			name:    "warning and ready",
+			results: []result{waitResult("Pod/a", health.HealthWarning, true)},
+		},
+		{
+			name: "mixed",
+			results: []result{
+				waitResult("Pod/a", health.HealthHealthy, true),
+				waitResult("Pod/b", health.HealthUnhealthy, true),
+				waitResult("Pod/c", health.HealthUnhealthy, true),
+			},
+			failed: []string{"Pod/b", "Pod/c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.failed, terminalFailures(tt.results))
+		})
+	}
+}
+
+func TestAllReady(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []result
+		ready   bool
+	}{
+		{
+			name:    "healthy and ready",
+			results: []result{waitResult("Pod/a", health.HealthHealthy, true)},
+			ready:   true,
+		},
+		{
+			name:    "healthy and not ready",
+			results: []result{waitResult("Pod/a", health.HealthHealthy, false)},
+		},
+		{
+			name:    "warning and ready",
+			results: []result{waitResult("Pod/a", health.HealthWarning, true)},
+		},
+		{
+			name:    "unknown and ready",
+			results: []result{waitResult("Pod/a", health.HealthUnknown, true)},
+		},
+		{
+			name: "one not ready",
+			results: []result{
+				waitResult("Pod/a", health.HealthHealthy, true),
+				waitResult("Pod/b", health.HealthHealthy, false),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.ready, allReady(tt.results))
+		})
+	}
+}
+
+func TestRunWaitTimeout(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pod.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: a
+status:
+  phase: Pending
+`), 0o600))
+
+	// the input is evaluated until the timeout, even when the interval is longer
+	start := time.Now()
+	err := runWait(waitOptions{file: file, interval: time.Minute, timeout: 100 * time.Millisecond}, nil)
+	assert.ErrorIs(t, err, errWaitTimeout)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	assert.Less(t, time.Since(start), time.Minute)
+}
+
+func TestLoadCustomizationsWatch(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "example.com", "Widget", "health.lua")
+	require.NoError(t, os.MkdirAll(filepath.Dir(script), 0o755))
+	require.NoError(t, os.WriteFile(script, []byte(`return {status = "Progressing"}`), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	loaded, err := loadCustomizations(ctx, []string{dir}, true)
+	require.NoError(t, err)
+	defer func() {
+		for _, dir := range loaded {
+			dir.Unload()
+		}
+	}()
+
+	objects, err := readObjects(strings.NewReader(`{"apiVersion": "example.com/v1", "kind": "Widget",
+"metadata": {"name": "test"}}`))
+	require.NoError(t, err)
+	results, err := evaluate(objects)
+	require.NoError(t, err)
+	assert.Equal(t, health.HealthUnknown, results[0].Health)
+
+	// wait re-evaluates the objects with the reloaded scripts
+	require.NoError(t, os.WriteFile(script, []byte(`return {status = "Healthy"}`), 0o600))
+	assert.Eventually(t, func() bool {
+		results, err := evaluate(objects)
+		return err == nil && results[0].Health == health.HealthHealthy
+	}, 5*time.Second, 10*time.Millisecond)
+}